@@ -4,18 +4,22 @@ go 1.14
 
 require (
 	github.com/ghodss/yaml v1.0.0
+	github.com/golang/snappy v0.0.1
 	github.com/onsi/ginkgo v1.16.1
 	github.com/onsi/gomega v1.10.1
-	github.com/prometheus/common v0.4.1
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/common v0.9.1
+	github.com/prometheus/prometheus v1.8.2-0.20200507164740-ecee9c8abfd1
 	github.com/sclevine/agouti v3.0.0+incompatible
 	github.com/stretchr/testify v1.6.1
 	golang.org/x/sys v0.0.0-20210414055047-fe65e336abe0 // indirect
 	gopkg.in/yaml.v2 v2.3.0
-	k8s.io/api v0.17.2
-	k8s.io/apiextensions-apiserver v0.17.2
-	k8s.io/apimachinery v0.17.2
-	k8s.io/client-go v0.17.2
+	k8s.io/api v0.17.5
+	k8s.io/apiextensions-apiserver v0.17.5
+	k8s.io/apimachinery v0.17.5
+	k8s.io/client-go v0.17.5
 	k8s.io/klog v1.0.0
 	sigs.k8s.io/kustomize/api v0.6.5
+	sigs.k8s.io/structured-merge-diff v1.0.1-0.20191108220359-b1b620dd3f06 // indirect
 	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,207 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package rulelint checks the custom rules of the thanos ruler without a hub, so the rule
+// fixtures can be validated by unit tests before they are applied
+package rulelint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	corev1 "k8s.io/api/core/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/open-cluster-management/observability-e2e-test/pkg/kustomize"
+)
+
+const (
+	// CustomRulesConfigMapName is the configmap the thanos ruler loads the custom rules from
+	CustomRulesConfigMapName = "thanos-ruler-custom-rules"
+	// DefaultEvaluationInterval is the evaluation interval of the groups without interval
+	DefaultEvaluationInterval = time.Minute
+)
+
+// RuleFile is a key of a rules configmap, which is loaded as a rule file by the thanos ruler
+type RuleFile struct {
+	ConfigMap string
+	Key       string
+	Content   []byte
+}
+
+// Problem is a problem found in a rule file, the group and rule are empty if the problem
+// concerns the whole file or group
+type Problem struct {
+	ConfigMap string
+	Key       string
+	Group     string
+	Rule      string
+	Err       error
+}
+
+func (p Problem) Error() string {
+	location := p.ConfigMap + "/" + p.Key
+	if p.Group != "" {
+		location += " group " + p.Group
+	}
+	if p.Rule != "" {
+		location += " rule " + p.Rule
+	}
+	return location + ": " + p.Err.Error()
+}
+
+// Options tune the checks
+type Options struct {
+	// EvaluationInterval is used for the groups without interval, defaults to DefaultEvaluationInterval
+	EvaluationInterval time.Duration
+}
+
+// ExtractRuleFiles returns the keys of the configmaps with the name in the multi-document yaml,
+// as rendered by kustomize.Render
+func ExtractRuleFiles(yamlB []byte, configMapName string) ([]RuleFile, error) {
+	files := []RuleFile{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(yamlB)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		cm := &corev1.ConfigMap{}
+		if err := yaml.Unmarshal(doc, cm); err != nil {
+			return nil, err
+		}
+		if cm.Kind != "ConfigMap" || cm.Name != configMapName {
+			continue
+		}
+		keys := make([]string, 0, len(cm.Data))
+		for key := range cm.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			files = append(files, RuleFile{ConfigMap: cm.Name, Key: key, Content: []byte(cm.Data[key])})
+		}
+	}
+	return files, nil
+}
+
+// ruleName returns the name and the kind, alert or record, of the rule
+func ruleName(rule rulefmt.RuleNode) (string, string) {
+	if rule.Record.Value != "" {
+		return rule.Record.Value, "record"
+	}
+	return rule.Alert.Value, "alert"
+}
+
+// Lint parses the rule files like the thanos ruler, which validates the names, the PromQL
+// expressions and the templates of the labels and annotations, and reports besides:
+// alerts with a for duration shorter than the evaluation interval, recording rules with templated
+// labels, and duplicate rules, i.e. alerts defined twice in a group or series recorded twice
+func Lint(files []RuleFile, opts Options) []Problem {
+	interval := opts.EvaluationInterval
+	if interval == 0 {
+		interval = DefaultEvaluationInterval
+	}
+
+	problems := []Problem{}
+	// recorded series are global, the same name and labels recorded twice conflict
+	recorded := map[string]string{}
+	for _, file := range files {
+		parsed, errs := rulefmt.Parse(file.Content)
+		for _, err := range errs {
+			problems = append(problems, Problem{ConfigMap: file.ConfigMap, Key: file.Key, Err: err})
+		}
+		if parsed == nil {
+			continue
+		}
+
+		for _, group := range parsed.Groups {
+			groupInterval := time.Duration(group.Interval)
+			if groupInterval == 0 {
+				groupInterval = interval
+			}
+			alerts := map[string]bool{}
+			for _, rule := range group.Rules {
+				name, kind := ruleName(rule)
+				problem := func(format string, args ...interface{}) {
+					problems = append(problems, Problem{
+						ConfigMap: file.ConfigMap,
+						Key:       file.Key,
+						Group:     group.Name,
+						Rule:      name,
+						Err:       fmt.Errorf(format, args...),
+					})
+				}
+
+				if kind == "alert" {
+					if alerts[name] {
+						problem("alert defined more than once in the group")
+					}
+					alerts[name] = true
+					if rule.For != 0 && time.Duration(rule.For) < groupInterval {
+						problem("for %s is shorter than the evaluation interval %s", rule.For, groupInterval)
+					}
+					continue
+				}
+
+				series := name + labelsString(rule.Labels)
+				if other, ok := recorded[series]; ok {
+					problem("series %s is recorded by %s as well", series, other)
+				}
+				recorded[series] = file.Key + " group " + group.Name
+				for labelName, value := range rule.Labels {
+					if strings.Contains(value, "{{") {
+						problem("label %s is a template, which is only expanded in alerts", labelName)
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+func labelsString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := []string{}
+	for name, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// LintYaml lints the custom rules configmap in the multi-document yaml
+func LintYaml(yamlB []byte, opts Options) ([]Problem, error) {
+	files, err := ExtractRuleFiles(yamlB, CustomRulesConfigMapName)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configmap %s found", CustomRulesConfigMapName)
+	}
+	return Lint(files, opts), nil
+}
+
+// LintKustomization renders the kustomization and lints the custom rules configmap
+func LintKustomization(path string, opts Options) ([]Problem, error) {
+	yamlB, err := kustomize.Render(kustomize.Options{KustomizationPath: path})
+	if err != nil {
+		return nil, err
+	}
+	return LintYaml(yamlB, opts)
+}
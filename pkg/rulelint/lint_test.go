@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rulelint
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintValidFixtures(t *testing.T) {
+	for _, path := range []string{
+		"../kustomize/tests",
+		"../../observability-gitops/alerts/custom_rules_valid",
+	} {
+		t.Run(path, func(t *testing.T) {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				t.Skipf("%s is not checked out", path)
+			}
+			problems, err := LintKustomization(path, Options{})
+			require.NoError(t, err)
+			assert.Empty(t, problems)
+		})
+	}
+}
+
+func TestLintInvalidFixture(t *testing.T) {
+	problems, err := LintKustomization("testdata/invalid", Options{})
+	require.NoError(t, err)
+
+	messages := []string{}
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	all := strings.Join(messages, "\n")
+	for _, expected := range []string{
+		`thanos-ruler-custom-rules/durations.yaml: `,
+		`not a valid duration string: "5 minutes"`,
+		`thanos-ruler-custom-rules/custom_rules.yaml: `,
+		`"NodeDown": could not parse expression`,
+		`"NodeOutOfMemory": annotation "summary"`,
+		`group node-health rule NodeOutOfMemory: for 30s is shorter than the evaluation interval 1m0s`,
+		`group node-health rule NodeOutOfMemory: alert defined more than once in the group`,
+		`group node-records rule cluster:node_memory_utilisation:ratio: label cluster is a template`,
+		`group node-records rule cluster:node_memory_utilisation:ratio: series cluster:node_memory_utilisation:ratio{cluster="{{ $labels.cluster }}"} is recorded by custom_rules.yaml group node-records as well`,
+	} {
+		assert.Contains(t, all, expected)
+	}
+	assert.NotContains(t, all, "NodeDown: for", "NodeDown has no for duration")
+
+	problems = Lint([]RuleFile{{ConfigMap: CustomRulesConfigMapName, Key: "custom_rules.yaml", Content: []byte(`groups:
+- name: node-health
+  interval: 15s
+  rules:
+  - alert: NodeOutOfMemory
+    expr: instance:node_memory_utilisation:ratio * 100 > 90
+    for: 30s
+`)}}, Options{})
+	assert.Empty(t, problems, "the group interval is shorter than for")
+}
+
+func TestLintYamlWithoutRules(t *testing.T) {
+	_, err := LintYaml([]byte("kind: ConfigMap\napiVersion: v1\nmetadata:\n  name: other\n"), Options{})
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ package tests
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -106,15 +107,24 @@ var _ = Describe("Observability:", func() {
 			}
 		})
 		// it takes Prometheus 5m to notice a metric is not available - https://github.com/prometheus/prometheus/issues/1810
-		// the corret way is use timestamp, for example:
-		// timestamp(node_memory_MemAvailable_bytes{cluster="local-cluster"}) - timestamp(node_memory_MemAvailable_bytes{cluster="local-cluster"} offset 1m) > 59
+		// so check the raw samples stored in the last minute instead of the instant query result
 		It("[Stable] Waiting for check no metric data in grafana console", func() {
+			selector, err := utils.BuildQuery(utils.Metric("node_memory_MemAvailable_bytes").Eq("cluster", clusterName))
+			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() error {
-				err, hasMetric := utils.ContainManagedClusterMetric(testOptions, `timestamp(node_memory_MemAvailable_bytes{cluster="`+clusterName+`}) - timestamp(node_memory_MemAvailable_bytes{cluster=`+clusterName+`"} offset 1m) > 59`, []string{`"__name__":"node_memory_MemAvailable_bytes"`})
-				if err != nil && !hasMetric && strings.Contains(err.Error(), "Failed to find metric name from response") {
-					return nil
+				client, err := utils.NewPrometheusClient(testOptions)
+				if err != nil {
+					return err
 				}
-				return fmt.Errorf("Check no metric data in grafana console error: %v", err)
+				end := time.Now()
+				matrix, err := client.QueryRawSamples(selector, end.Add(-time.Minute), end)
+				if err != nil {
+					return fmt.Errorf("Check no metric data in grafana console error: %v", err)
+				}
+				if len(matrix) > 0 {
+					return fmt.Errorf("Found %d series of %s with samples in the last minute", len(matrix), selector)
+				}
+				return nil
 			}, EventuallyTimeoutMinute*2, EventuallyIntervalSecond*5).Should(Succeed())
 		})
 
@@ -173,6 +183,49 @@ var _ = Describe("Observability:", func() {
 		}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*1).Should(BeTrue())
 	})
 
+	It("[P2][Sev2][Observability][Stable] Should collect metrics at the interval set in observabilityAddonSpec (addon/g0)", func() {
+		originalInterval, err := utils.GetMCOAddonSpecInterval(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		interval := 60 * time.Second
+		isHub := len(testOptions.ManagedClusters) == 0
+		cluster := "local-cluster"
+		if !isHub {
+			cluster = utils.GetManagedClusterName(testOptions)
+		}
+		defer func() {
+			By("Restoring the original interval")
+			Eventually(func() error {
+				return utils.ModifyMCOAddonSpecInterval(testOptions, int64(originalInterval.Seconds()))
+			}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*5).Should(Succeed())
+			Eventually(func() error {
+				return utils.CheckMetricsCollectorInterval(testOptions, isHub, originalInterval)
+			}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(Succeed())
+		}()
+
+		By("Setting interval to 60")
+		Eventually(func() error {
+			return utils.ModifyMCOAddonSpecInterval(testOptions, int64(interval.Seconds()))
+		}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*5).Should(Succeed())
+
+		By("Waiting for metrics-collector to roll out with the new interval")
+		Eventually(func() error {
+			return utils.CheckMetricsCollectorInterval(testOptions, isHub, interval)
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(Succeed())
+		rolledOut := time.Now()
+
+		By("Measuring the spacing of the samples collected after the rollout")
+		selector, err := utils.BuildQuery(utils.Metric("node_memory_MemAvailable_bytes").Eq("cluster", cluster))
+		Expect(err).NotTo(HaveOccurred())
+		window := 5 * interval
+		Eventually(func() error {
+			end := time.Now()
+			if end.Sub(rolledOut) < window {
+				return fmt.Errorf("waiting for %s of samples collected every %s", window, interval)
+			}
+			return utils.CheckSampleSpacing(testOptions, selector, end.Add(-window), end, interval)
+		}, EventuallyTimeoutMinute*5+window, EventuallyIntervalSecond*30).Should(Succeed())
+	})
+
 	Context("[P2][Sev2][Observability] Should not have the expected MCO addon pods when disable observability from managedcluster (addon/g0) -", func() {
 		It("[Integration] Modifying managedcluster cr to disable observability", func() {
 			Skip("Modifying managedcluster cr to disable observability")
@@ -5,6 +5,7 @@ package tests
 
 import (
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -13,12 +14,12 @@ import (
 	"k8s.io/klog"
 
 	"github.com/open-cluster-management/observability-e2e-test/pkg/kustomize"
+	"github.com/open-cluster-management/observability-e2e-test/pkg/rulelint"
 	"github.com/open-cluster-management/observability-e2e-test/pkg/utils"
 )
 
 var (
-	ThanosRuleName       = MCO_CR_NAME + "-thanos-rule"
-	ThanosRuleRestarting = false
+	ThanosRuleName = MCO_CR_NAME + "-thanos-rule"
 )
 
 var _ = Describe("Observability:", func() {
@@ -34,6 +35,8 @@ var _ = Describe("Observability:", func() {
 			testOptions.HubCluster.KubeContext)
 	})
 	statefulset := [...]string{MCO_CR_NAME + "-alertmanager", ThanosRuleName}
+	// follows the custom alert from the moment the custom rules are created until they are updated
+	var alertTracker *utils.AlertTracker
 	configmap := [...]string{"thanos-ruler-default-rules", "thanos-ruler-custom-rules"}
 	secret := "alertmanager-config"
 
@@ -65,6 +68,13 @@ var _ = Describe("Observability:", func() {
 		klog.V(3).Infof("Configmap %s does exist", configmap[0])
 	})
 
+	It("[P2][Sev2][Observability][Stable] Should evaluate the default rules successfully (alert/g0)", func() {
+		By("Checking the rule status of thanos rule and the recorded series")
+		Eventually(func() error {
+			return utils.CheckThanosRules(testOptions)
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*30).Should(Succeed())
+	})
+
 	It("[P3][Sev3][Observability][Stable] Should not have the CM: thanos-ruler-custom-rules (alert/g0)", func() {
 		By("Checking if CM: thanos-ruler-custom-rules not existed")
 		_, err := hubClient.CoreV1().ConfigMaps(MCO_NAMESPACE).Get(configmap[1], metav1.GetOptions{})
@@ -89,59 +99,122 @@ var _ = Describe("Observability:", func() {
 
 	It("[P2][Sev2][Observability][Stable] Should have custom alert generated (alert/g0)", func() {
 		By("Creating custom alert rules")
-		_, oldSts := utils.GetStatefulSet(testOptions, true, ThanosRuleName, MCO_NAMESPACE)
+		rollout, err := utils.NewRollout(testOptions, true, utils.KindStatefulSet, MCO_NAMESPACE, ThanosRuleName)
+		Expect(err).NotTo(HaveOccurred())
 
 		yamlB, err := kustomize.Render(kustomize.Options{KustomizationPath: "../../observability-gitops/alerts/custom_rules_valid"})
 		Expect(err).NotTo(HaveOccurred())
+		problems, err := rulelint.LintYaml(yamlB, rulelint.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(problems).To(BeEmpty())
+
+		var labelName, labelValue string
+		labels, err := kustomize.GetLabels(yamlB)
+		Expect(err).NotTo(HaveOccurred())
+		for labelName = range labels.(map[string]interface{}) {
+			labelValue = labels.(map[string]interface{})[labelName].(string)
+		}
+		alertTracker, err = utils.NewAlertTracker(testOptions, map[string]string{labelName: labelValue})
+		Expect(err).NotTo(HaveOccurred())
 		Expect(utils.Apply(testOptions.HubCluster.MasterURL, testOptions.KubeConfig, testOptions.HubCluster.KubeContext, yamlB)).NotTo(HaveOccurred())
 
 		By("Wait for thanos rule pods are restarted and ready")
-		// ensure the thanos rule pods are restarted successfully before processing
+		// ensure the thanos rule pods are restarted successfully before processing, the alert is
+		// tracked meanwhile so that it is observed pending before it fires
 		Eventually(func() error {
-			if !ThanosRuleRestarting {
-				_, newSts := utils.GetStatefulSet(testOptions, true, ThanosRuleName, MCO_NAMESPACE)
-
-				if oldSts.GetResourceVersion() == newSts.GetResourceVersion() {
-					return fmt.Errorf("The %s is not being restarted in 10 minutes", ThanosRuleName)
-				} else {
-					ThanosRuleRestarting = true
-				}
+			if _, err := alertTracker.Observe(); err != nil {
+				klog.V(3).Infof("failed to observe the alert during the rollout: %v", err)
 			}
+			return rollout.Progress(true)
+		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*10).Should(Succeed())
 
-			err = utils.CheckStatefulSetPodReady(testOptions, MCO_CR_NAME+"-thanos-rule", 3)
-			if err != nil {
-				return err
-			}
-			return nil
-		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*5).Should(Succeed())
+		By("Checking alert has been pending for the for duration of the rule before firing")
+		Eventually(func() error {
+			return alertTracker.Await(utils.AlertFiring)
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*10).Should(Succeed())
+		Expect(utils.CheckAlertLifecycle(alertTracker.Lifecycle, EventuallyIntervalSecond*10)).NotTo(HaveOccurred())
 
-		var labelName, labelValue string
-		labels, err := kustomize.GetLabels(yamlB)
+		query, err := utils.BuildQuery(utils.Metric("ALERTS").Eq(labelName, labelValue).Offset(time.Minute))
 		Expect(err).NotTo(HaveOccurred())
-		for labelName = range labels.(map[string]interface{}) {
-			labelValue = labels.(map[string]interface{})[labelName].(string)
-		}
 
 		By("Checking alert generated")
 		Eventually(func() error {
-			err, _ := utils.ContainManagedClusterMetric(testOptions, `ALERTS{`+labelName+`="`+labelValue+`"} offset 1m`,
-				[]string{`"__name__":"ALERTS"`, `"` + labelName + `":"` + labelValue + `"`})
+			err, _ := utils.ContainManagedClusterMetric(testOptions, query,
+				[]string{`"__name__":"ALERTS"`, fmt.Sprintf("%q:%q", labelName, labelValue)})
 			return err
 		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(Succeed())
+
+		By("Checking alert can be silenced in alertmanager")
+		client, stop, err := utils.NewAlertmanagerClient(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer stop()
+		alertLabels := map[string]string{labelName: labelValue}
+		Eventually(func() error {
+			alerts, err := client.Alerts(utils.AlertFilter{Matchers: []string{fmt.Sprintf("%s=%q", labelName, labelValue)}})
+			if err != nil {
+				return err
+			}
+			if len(alerts) == 0 {
+				return fmt.Errorf("Failed to find the alert with label %s=%s in alertmanager", labelName, labelValue)
+			}
+			return nil
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(Succeed())
+
+		silenceID, err := client.CreateSilence(utils.NewSilence(alertLabels, 10*time.Minute, "silenced by the alert e2e test"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() error {
+			return utils.CheckAlertSuppressed(client, alertLabels, silenceID)
+		}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*5).Should(Succeed())
+		Expect(client.ExpireSilence(silenceID)).NotTo(HaveOccurred())
 	})
 
 	It("[P2][Sev2][Observability][Stable] Should modify the SECRET: alertmanager-config (alert/g0)", func() {
-		By("Editing the secret, we should be able to add the third partying tools integrations")
-		secret := utils.CreateCustomAlertConfigYaml(testOptions.HubCluster.BaseDomain)
+		By("Deploying the webhook receiver recording the alerts")
+		recorder, err := utils.DeployWebhookRecorder(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(utils.DeleteWebhookRecorder(testOptions)).NotTo(HaveOccurred())
+		}()
 
+		By("Editing the secret, we should be able to add the third partying tools integrations")
+		// deferred after the receiver cleanup, so the original config is restored before the receiver is deleted
+		original, err := utils.GetAlertmanagerConfigSecret(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(utils.RestoreAlertmanagerConfigSecret(testOptions, original)).NotTo(HaveOccurred())
+		}()
+		secret, err := utils.CreateCustomAlertConfigYaml(recorder.URL())
+		Expect(err).NotTo(HaveOccurred())
+		since := time.Now()
 		Expect(utils.Apply(testOptions.HubCluster.MasterURL, testOptions.KubeConfig, testOptions.HubCluster.KubeContext, secret)).NotTo(HaveOccurred())
 		klog.V(3).Infof("Successfully modified the secret: alertmanager-config")
+
+		By("Checking alertmanager has reloaded the modified config")
+		Eventually(func() error {
+			return utils.CheckAlertmanagerConfigReloaded(testOptions)
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*10).Should(Succeed())
+
+		yamlB, err := kustomize.Render(kustomize.Options{KustomizationPath: "../../observability-gitops/alerts/custom_rules_valid"})
+		Expect(err).NotTo(HaveOccurred())
+		labels, err := kustomize.GetLabels(yamlB)
+		Expect(err).NotTo(HaveOccurred())
+		alertLabels := map[string]string{}
+		for labelName, labelValue := range labels.(map[string]interface{}) {
+			alertLabels[labelName] = labelValue.(string)
+		}
+
+		By("Checking the custom alert is delivered to the webhook receiver")
+		Eventually(func() error {
+			return utils.CheckAlertDelivered(recorder, alertLabels, "firing", since, EventuallyTimeoutMinute*5)
+		}, EventuallyTimeoutMinute*6, EventuallyIntervalSecond*10).Should(Succeed())
 	})
 
 	It("[P2][Sev2][Observability][Stable] Should have custom alert updated (alert/g0)", func() {
 		By("Updating custom alert rules")
 
-		yamlB, _ := kustomize.Render(kustomize.Options{KustomizationPath: "../../observability-gitops/alerts/custom_rules_invalid"})
+		yamlB, err := kustomize.Render(kustomize.Options{KustomizationPath: "../../observability-gitops/alerts/custom_rules_invalid"})
+		Expect(err).NotTo(HaveOccurred())
+		updated := time.Now()
 		Expect(utils.Apply(testOptions.HubCluster.MasterURL, testOptions.KubeConfig, testOptions.HubCluster.KubeContext, yamlB)).NotTo(HaveOccurred())
 
 		var labelName, labelValue string
@@ -150,42 +223,37 @@ var _ = Describe("Observability:", func() {
 			labelValue = labels.(map[string]interface{})[labelName].(string)
 		}
 
+		query, err := utils.BuildQuery(utils.Metric("ALERTS").Eq(labelName, labelValue).Offset(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+
 		By("Checking alert generated")
 		Eventually(func() error {
-			err, _ := utils.ContainManagedClusterMetric(testOptions, `ALERTS{`+labelName+`="`+labelValue+`"} offset 1m`,
-				[]string{`"__name__":"ALERTS"`, `"` + labelName + `":"` + labelValue + `"`})
+			err, _ := utils.ContainManagedClusterMetric(testOptions, query,
+				[]string{`"__name__":"ALERTS"`, fmt.Sprintf("%q:%q", labelName, labelValue)})
 			return err
 		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(MatchError("Failed to find metric name from response"))
+
+		if alertTracker != nil {
+			By("Checking the custom alert is resolved after the rules are updated")
+			Eventually(func() error {
+				return alertTracker.Await(utils.AlertResolved)
+			}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*10).Should(Succeed())
+			Expect(utils.CheckAlertResolved(alertTracker.Lifecycle, updated, EventuallyTimeoutMinute*10)).NotTo(HaveOccurred())
+		}
 	})
 
 	It("[P2][Sev2][Observability][Stable] delete the customized rules (alert/g0)", func() {
-		_, oldSts := utils.GetStatefulSet(testOptions, true, ThanosRuleName, MCO_NAMESPACE)
+		rollout, err := utils.NewRollout(testOptions, true, utils.KindStatefulSet, MCO_NAMESPACE, ThanosRuleName)
+		Expect(err).NotTo(HaveOccurred())
 
 		Eventually(func() error {
 			err := hubClient.CoreV1().ConfigMaps(MCO_NAMESPACE).Delete(configmap[1], &metav1.DeleteOptions{})
 			return err
 		}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*1).Should(Succeed())
 
-		ThanosRuleRestarting = false
 		By("Wait for thanos rule pods are restarted and ready")
 		// ensure the thanos rule pods are restarted successfully before processing
-		Eventually(func() error {
-			if !ThanosRuleRestarting {
-				_, newSts := utils.GetStatefulSet(testOptions, true, ThanosRuleName, MCO_NAMESPACE)
-
-				if oldSts.GetResourceVersion() == newSts.GetResourceVersion() {
-					return fmt.Errorf("The %s is not being restarted in 10 minutes", ThanosRuleName)
-				} else {
-					ThanosRuleRestarting = true
-				}
-			}
-
-			err = utils.CheckStatefulSetPodReady(testOptions, MCO_CR_NAME+"-thanos-rule", 3)
-			if err != nil {
-				return err
-			}
-			return nil
-		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*5).Should(Succeed())
+		Expect(rollout.Wait(true, EventuallyTimeoutMinute*10)).NotTo(HaveOccurred())
 
 		klog.V(3).Infof("Successfully deleted CM: thanos-ruler-custom-rules")
 	})
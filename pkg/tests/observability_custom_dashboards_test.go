@@ -15,6 +15,14 @@ const (
 	dashboardName        = "sample-dashboard"
 	dashboardTitle       = "Sample Dashboard for E2E"
 	updateDashboardTitle = "Update Sample Dashboard for E2E"
+
+	folderDashboardName        = "e2e-folder-dashboard"
+	folderDashboardUID         = "e2e-folder-dashboard"
+	folderDashboardTitle       = "Folder Dashboard for E2E"
+	updateFolderDashboardTitle = "Update Folder Dashboard for E2E"
+	dashboardFolder            = "E2E Custom Dashboards"
+	unlabeledDashboardName     = "e2e-unlabeled-dashboard"
+	unlabeledDashboardUID      = "e2e-unlabeled-dashboard"
 )
 
 var _ = Describe("Observability:", func() {
@@ -64,6 +72,64 @@ var _ = Describe("Observability:", func() {
 		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*5).Should(BeFalse())
 	})
 
+	It("[P2][Sev2][Observability][Stable] Should load the dashboard of a labeled configmap into the folder of its annotation (dashboard/g0)", func() {
+		client, stop, err := utils.NewGrafanaClient(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer stop()
+
+		By("Creating a labeled dashboard configmap with a folder annotation and an unlabeled one")
+		cm, err := utils.NewDashboardConfigMap(folderDashboardName, folderDashboardUID, folderDashboardTitle, dashboardFolder, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.CreateConfigMap(testOptions, true, cm)).NotTo(HaveOccurred())
+		cm, err = utils.NewDashboardConfigMap(unlabeledDashboardName, unlabeledDashboardUID, "Unlabeled Dashboard for E2E", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.CreateConfigMap(testOptions, true, cm)).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			return utils.CheckDashboardLoaded(client, folderDashboardUID, folderDashboardTitle, dashboardFolder)
+		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*5).Should(Succeed())
+		Consistently(func() bool {
+			_, err := client.Dashboard(unlabeledDashboardUID)
+			return utils.IsGrafanaNotFound(err)
+		}, EventuallyIntervalSecond*30, EventuallyIntervalSecond*5).Should(BeTrue())
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should update the dashboard in place after its configmap updated (dashboard/g0)", func() {
+		client, stop, err := utils.NewGrafanaClient(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer stop()
+
+		By("Updating the title of the dashboard in the configmap")
+		cm, err := utils.NewDashboardConfigMap(folderDashboardName, folderDashboardUID, updateFolderDashboardTitle, dashboardFolder, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.CreateConfigMap(testOptions, true, cm)).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			return utils.CheckDashboardLoaded(client, folderDashboardUID, updateFolderDashboardTitle, dashboardFolder)
+		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*5).Should(Succeed())
+		hits, err := client.Search(utils.SearchQuery{Query: updateFolderDashboardTitle, Type: "dash-db"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hits).To(HaveLen(1))
+		Expect(hits[0].UID).To(Equal(folderDashboardUID))
+		hit, err := client.FindDashboard(folderDashboardTitle)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hit).To(BeNil())
+	})
+
+	It("[P2][Sev2][Observability][Integration] Should remove the dashboard and its empty folder after its configmap removed (dashboard/g0)", func() {
+		client, stop, err := utils.NewGrafanaClient(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer stop()
+
+		By("Deleting the dashboard configmaps")
+		Expect(utils.DeleteConfigMap(testOptions, true, folderDashboardName, MCO_NAMESPACE)).NotTo(HaveOccurred())
+		Expect(utils.DeleteConfigMap(testOptions, true, unlabeledDashboardName, MCO_NAMESPACE)).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			return utils.CheckDashboardRemoved(client, folderDashboardUID, dashboardFolder)
+		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*5).Should(Succeed())
+	})
+
 	AfterEach(func() {
 		testFailed = testFailed || CurrentGinkgoTestDescription().Failed
 		if testFailed {
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package tests
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/open-cluster-management/observability-e2e-test/pkg/utils"
+)
+
+var _ = Describe("Observability:", func() {
+	syntheticMetrics := []utils.SyntheticMetric{
+		{Name: "e2e_synthetic_gauge", Labels: map[string]string{"scenario": "exact", "shard": "0"}, Value: 42},
+		{Name: "e2e_synthetic_gauge", Labels: map[string]string{"scenario": "exact", "shard": "1"}, Value: 0.125},
+		{Name: "e2e_synthetic_renamed", Labels: map[string]string{"scenario": "rename"}, Value: 7},
+	}
+	syntheticNames := []string{"e2e_synthetic_gauge", "e2e_synthetic_renamed"}
+	syntheticRenames := map[string]string{"e2e_synthetic_renamed": "e2e_synthetic_renamed_total"}
+	// deploy the exporter to the managed cluster, or to the hub which is imported as local-cluster
+	var isHub bool
+
+	BeforeEach(func() {
+		isHub = len(testOptions.ManagedClusters) == 0
+		hubClient = utils.NewKubeClient(
+			testOptions.HubCluster.MasterURL,
+			testOptions.KubeConfig,
+			testOptions.HubCluster.KubeContext)
+
+		dynClient = utils.NewKubeClientDynamic(
+			testOptions.HubCluster.MasterURL,
+			testOptions.KubeConfig,
+			testOptions.HubCluster.KubeContext)
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should have the exact values of the synthetic exporter metrics (exporter/g0)", func() {
+		By("Deploying the synthetic exporter and adding its metrics to the custom allowlist")
+		Expect(utils.DeploySyntheticExporter(testOptions, isHub, syntheticMetrics)).NotTo(HaveOccurred())
+		Expect(utils.UpdateCustomAllowlist(testOptions, syntheticNames, syntheticRenames, false)).NotTo(HaveOccurred())
+
+		cluster := "local-cluster"
+		if !isHub {
+			cluster = utils.GetManagedClusterName(testOptions)
+		}
+		By("Waiting for the synthetic metrics on the hub")
+		Eventually(func() error {
+			client, err := utils.NewPrometheusClient(testOptions)
+			if err != nil {
+				return err
+			}
+			return utils.CheckSyntheticMetrics(client, cluster, syntheticMetrics, syntheticRenames)
+		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*10).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(utils.UpdateCustomAllowlist(testOptions, syntheticNames, syntheticRenames, true)).NotTo(HaveOccurred())
+		Expect(utils.DeleteSyntheticExporter(testOptions, isHub)).NotTo(HaveOccurred())
+
+		testFailed = testFailed || CurrentGinkgoTestDescription().Failed
+		if testFailed {
+			utils.PrintMCOObject(testOptions)
+			utils.PrintAllMCOPodsStatus(testOptions)
+			utils.PrintAllOBAPodsStatus(testOptions)
+		} else {
+			Expect(utils.IntegrityChecking(testOptions)).NotTo(HaveOccurred())
+		}
+	})
+})
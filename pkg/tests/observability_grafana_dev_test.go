@@ -4,29 +4,49 @@
 package tests
 
 import (
-	"bytes"
-	"os/exec"
-
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"k8s.io/klog"
 
+	"github.com/open-cluster-management/observability-e2e-test/pkg/kustomize"
 	"github.com/open-cluster-management/observability-e2e-test/pkg/utils"
 )
 
 var _ = Describe("Observability:", func() {
+	BeforeEach(func() {
+		hubClient = utils.NewKubeClient(
+			testOptions.HubCluster.MasterURL,
+			testOptions.KubeConfig,
+			testOptions.HubCluster.KubeContext)
+
+		dynClient = utils.NewKubeClientDynamic(
+			testOptions.HubCluster.MasterURL,
+			testOptions.KubeConfig,
+			testOptions.HubCluster.KubeContext)
+	})
 
 	It("[P1][Sev1][Observability][Integration] Should run grafana-dev test successfully (grafana-dev/g0)", func() {
-		Eventually(func() error {
-			cmd := exec.Command("../../cicd-scripts/grafana-dev-test.sh")
-			var out bytes.Buffer
-			cmd.Stdout = &out
-			err := cmd.Run()
-			if err != nil {
-				klog.V(1).Infof("Failed to run grafana-dev-test.sh: %v", out.String())
-			}
-			return err
-		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*5).Should(Succeed())
+		By("Creating custom dashboard configmap to export")
+		yamlB, err := kustomize.Render(kustomize.Options{KustomizationPath: "../../observability-gitops/dashboards/sample_custom_dashboard"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.Apply(testOptions.HubCluster.MasterURL, testOptions.KubeConfig, testOptions.HubCluster.KubeContext, yamlB)).NotTo(HaveOccurred())
+		defer func() {
+			Expect(utils.DeleteConfigMap(testOptions, true, dashboardName, MCO_NAMESPACE)).NotTo(HaveOccurred())
+		}()
+
+		scenario := &utils.GrafanaDevScenario{
+			DashboardTitle: dashboardTitle,
+			User:           utils.NewGrafanaUser{Name: "test", Email: "test", Login: "test", Password: "test"},
+			Timeout:        EventuallyTimeoutMinute * 5,
+		}
+		By("Deploying grafana-dev, switching a new user to grafana admin and exporting the dashboard")
+		err = scenario.Run(testOptions)
+		By("Cleaning grafana-dev")
+		Expect(scenario.Clean(testOptions)).NotTo(HaveOccurred())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(scenario.ConfigMap.Name).To(Equal(dashboardName + "-for-e2e"))
+		Expect(scenario.ConfigMap.Labels).To(HaveKeyWithValue(utils.GrafanaCustomDashboardLabel, "true"))
+		Expect(scenario.ConfigMap.Data).To(HaveKeyWithValue(dashboardName+"-for-e2e.json", ContainSubstring(`"title": "`+dashboardTitle+`"`)))
 	})
 
 	AfterEach(func() {
@@ -4,12 +4,25 @@
 package tests
 
 import (
+	"fmt"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"k8s.io/klog"
 
 	"github.com/open-cluster-management/observability-e2e-test/pkg/utils"
 )
 
+// goldenDashboardsDir has the golden files of the dashboards managed by the operator
+const goldenDashboardsDir = "testdata/dashboards"
+
+// emptyPanelsAllowed lists by dashboard title the panels which legitimately have no data on a
+// test cluster, e.g. "<dashboard title>": {"<panel title>"}, each with the reason it is empty.
+// Until it is filled from the report of a hub run, the panels without data are only reported,
+// afterwards every other panel without data fails the panel queries spec
+var emptyPanelsAllowed = map[string][]string{}
+
 var _ = Describe("Observability:", func() {
 	BeforeEach(func() {
 		hubClient = utils.NewKubeClient(
@@ -25,11 +38,103 @@ var _ = Describe("Observability:", func() {
 
 	It("[P1][Sev1][Observability][Stable] Should have metric data in grafana console (grafana/g0)", func() {
 		Eventually(func() error {
-			err, _ = utils.ContainManagedClusterMetric(testOptions, "node_memory_MemAvailable_bytes", []string{`"__name__":"node_memory_MemAvailable_bytes"`})
+			client, err := utils.NewPrometheusClient(testOptions)
+			if err != nil {
+				return err
+			}
+			vector, err := client.QueryVector("node_memory_MemAvailable_bytes")
+			if err != nil {
+				return err
+			}
+			if !utils.ContainsSample(vector, utils.HasLabels(map[string]string{"__name__": "node_memory_MemAvailable_bytes"}), utils.ValueGreaterThan(0)) {
+				return fmt.Errorf("Failed to find node_memory_MemAvailable_bytes with a positive value in %d series", len(vector))
+			}
+			return nil
+		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*5).Should(Succeed())
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should query the samples written to observatorium-api (grafana/g0)", func() {
+		By("Writing a probe sample with the managed cluster certificate")
+		var result *utils.ProbeResult
+		Eventually(func() error {
+			var err error
+			result, err = utils.RunRemoteWriteProbe(testOptions, len(testOptions.ManagedClusters) == 0, EventuallyTimeoutMinute*2)
 			return err
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*10).Should(Succeed())
+		klog.V(1).Infof("probe sample %s is queryable %s after it is written", result.ProbeID, result.Latency())
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should have metrics ingested within the lag SLO (grafana/g0)", func() {
+		By("Measuring the ingestion lag of every managed cluster for 2 minutes")
+		Expect(utils.CheckIngestionLagSLO(testOptions, 2*time.Minute)).To(Succeed())
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should have healthy datasources in grafana (grafana/g0)", func() {
+		client, stop, err := utils.NewGrafanaClient(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer stop()
+		Eventually(func() error {
+			// the frontend settings are readable by the viewers, unlike the datasources API
+			datasources, err := client.FrontendDatasources()
+			if err != nil {
+				return err
+			}
+			if len(datasources) == 0 {
+				return fmt.Errorf("Failed to find any datasource in grafana")
+			}
+			for _, datasource := range datasources {
+				if datasource.Type != "prometheus" {
+					continue
+				}
+				if err := client.CheckDatasourceHealth(datasource); err != nil {
+					return err
+				}
+			}
+			return nil
 		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*5).Should(Succeed())
 	})
 
+	It("[P2][Sev2][Observability][Stable] Should run the panel queries of the dashboards without errors (grafana/g0)", func() {
+		tester, stop, err := utils.NewPanelQueryTester(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		defer stop()
+		Eventually(func() error {
+			report, err := tester.TestDashboards()
+			if err != nil {
+				return err
+			}
+			klog.V(1).Infof("panel queries of the dashboards: %s", report)
+			if failed := report.Failed(); len(failed) > 0 {
+				return fmt.Errorf("panel queries failed in %d dashboards: %s", len(failed), utils.DashboardQueryReport{Queries: report.Queries, Problems: failed})
+			}
+			if empty := report.NoDataExcept(emptyPanelsAllowed); len(empty) > 0 {
+				emptyReport := utils.DashboardQueryReport{Queries: report.Queries, Problems: empty}
+				if len(emptyPanelsAllowed) == 0 {
+					klog.Warningf("panel queries returned no data in %d dashboards, not failing until emptyPanelsAllowed is filled: %s", len(empty), emptyReport)
+					return nil
+				}
+				return fmt.Errorf("panel queries returned no data in %d dashboards: %s", len(empty), emptyReport)
+			}
+			return nil
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*30).Should(Succeed())
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should have the default dashboards unchanged from the golden files (grafana/g0)", func() {
+		golden := utils.NewDashboardGolden(goldenDashboardsDir)
+		if !golden.Update {
+			files, err := golden.Files()
+			Expect(err).NotTo(HaveOccurred())
+			// the spec is skipped until the golden files are exported from a hub and committed
+			if len(files) == 0 {
+				Skip(fmt.Sprintf("no golden dashboard in %s, run with %s=true to create them",
+					goldenDashboardsDir, utils.UpdateGoldenDashboardsEnv))
+			}
+		}
+		Eventually(func() error {
+			return utils.CheckDashboardGoldenFiles(testOptions, goldenDashboardsDir)
+		}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*10).Should(Succeed())
+	})
+
 	AfterEach(func() {
 		testFailed = testFailed || CurrentGinkgoTestDescription().Failed
 		if testFailed {
@@ -5,6 +5,7 @@ package tests
 
 import (
 	"errors"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -87,10 +88,18 @@ var _ = Describe("Observability:", func() {
 			})
 
 			It("[Stable] Checking metric to ensure that no data is lost in 1 minute", func() {
+				interval, err := utils.GetMCOAddonSpecInterval(testOptions)
+				Expect(err).NotTo(HaveOccurred())
+				window := time.Minute
+				if window < 3*interval {
+					window = 3 * interval
+				}
+				selector, err := utils.BuildQuery(utils.Metric("node_memory_MemAvailable_bytes").Eq("cluster", clusterName))
+				Expect(err).NotTo(HaveOccurred())
 				Eventually(func() error {
-					err, _ = utils.ContainManagedClusterMetric(testOptions, `timestamp(node_memory_MemAvailable_bytes{cluster="`+clusterName+`}) - timestamp(node_memory_MemAvailable_bytes{cluster=`+clusterName+`"} offset 1m) > 59`, []string{`"__name__":"node_memory_MemAvailable_bytes"`})
-					return err
-				}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*3).Should(Succeed())
+					end := time.Now()
+					return utils.CheckNoDataLoss(testOptions, selector, end.Add(-window), end, interval)
+				}, EventuallyTimeoutMinute*1+window, EventuallyIntervalSecond*3).Should(Succeed())
 			})
 		}
 	})
@@ -4,6 +4,8 @@
 package tests
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -35,13 +37,31 @@ var _ = Describe("Observability:", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(utils.Apply(testOptions.HubCluster.MasterURL, testOptions.KubeConfig, testOptions.HubCluster.KubeContext, yamlB)).NotTo(HaveOccurred())
 
+		query, err := utils.BuildQuery(utils.Metric("node_memory_Active_bytes").Offset(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+
 		By("Waiting for new added metrics on grafana console")
 		Eventually(func() error {
-			err, _ := utils.ContainManagedClusterMetric(testOptions, "node_memory_Active_bytes offset 1m", []string{`"__name__":"node_memory_Active_bytes"`})
+			err, _ := utils.ContainManagedClusterMetric(testOptions, query, []string{`"__name__":"node_memory_Active_bytes"`})
 			return err
 		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*5).Should(Succeed())
 	})
 
+	It("[P2][Sev2][Observability][Stable] Should collect only the metrics in default and custom metrics allowlist (metricslist/g0)", func() {
+		By("Comparing the metrics of every managed cluster with the allowlists")
+		Eventually(func() error {
+			return utils.CheckMetricsAllowlist(testOptions)
+		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*30).Should(Succeed())
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should keep series within the cardinality budget with custom metrics allowlist (metricslist/g0)", func() {
+		budget, err := utils.GetCardinalityBudget(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Counting series per managed cluster and per metric name")
+		Expect(utils.CheckCardinalityBudget(testOptions, budget)).To(Succeed())
+	})
+
 	It("[P2][Sev2][Observability][Stable] Should have no metrics after custom metrics allowlist deleted (metricslist/g0)", func() {
 		By("Deleting custom metrics allowlist configmap")
 		Eventually(func() error {
@@ -49,9 +69,12 @@ var _ = Describe("Observability:", func() {
 			return err
 		}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*1).Should(Succeed())
 
+		query, err := utils.BuildQuery(utils.Metric("node_memory_Active_bytes").Offset(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+
 		By("Waiting for new added metrics disappear on grafana console")
 		Eventually(func() error {
-			err, _ := utils.ContainManagedClusterMetric(testOptions, "node_memory_Active_bytes offset 1m", []string{`"__name__":"node_memory_Active_bytes"`})
+			err, _ := utils.ContainManagedClusterMetric(testOptions, query, []string{`"__name__":"node_memory_Active_bytes"`})
 			return err
 		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*5).Should(MatchError("Failed to find metric name from response"))
 	})
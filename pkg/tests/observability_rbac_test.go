@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package tests
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/open-cluster-management/observability-e2e-test/pkg/utils"
+)
+
+var _ = Describe("Observability:", func() {
+	identities := []*utils.QueryIdentity{}
+
+	BeforeEach(func() {
+		hubClient = utils.NewKubeClient(
+			testOptions.HubCluster.MasterURL,
+			testOptions.KubeConfig,
+			testOptions.HubCluster.KubeContext)
+
+		dynClient = utils.NewKubeClientDynamic(
+			testOptions.HubCluster.MasterURL,
+			testOptions.KubeConfig,
+			testOptions.HubCluster.KubeContext)
+	})
+
+	It("[P2][Sev2][Observability][Stable] Should only query the metrics of the allowed clusters through rbac-query-proxy (rbac/g0)", func() {
+		clusters, err := utils.ListObservabilityEnabledClusters(testOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusters).NotTo(BeEmpty())
+
+		By("Creating a service account with access to each managed cluster namespace and one without access")
+		allowed := map[string][]string{"mco-e2e-rbac-none": {}}
+		for _, cluster := range clusters {
+			allowed["mco-e2e-rbac-"+cluster] = []string{cluster}
+		}
+		for name, clusters := range allowed {
+			var identity *utils.QueryIdentity
+			Eventually(func() error {
+				identity, err = utils.CreateQueryIdentity(testOptions, name, clusters)
+				return err
+			}, EventuallyTimeoutMinute*1, EventuallyIntervalSecond*5).Should(Succeed())
+			identities = append(identities, identity)
+		}
+
+		query, err := utils.BuildQuery(utils.Metric("node_memory_MemAvailable_bytes"))
+		Expect(err).NotTo(HaveOccurred())
+		for _, identity := range identities {
+			By("Querying rbac-query-proxy as " + identity.Name)
+			Eventually(func() error {
+				client, err := utils.NewPrometheusClientForIdentity(testOptions, identity)
+				if err != nil {
+					return err
+				}
+				return utils.CheckQueryIsolation(client, query, identity.Clusters)
+			}, EventuallyTimeoutMinute*3, EventuallyIntervalSecond*10).Should(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		for _, identity := range identities {
+			Expect(utils.DeleteQueryIdentity(testOptions, identity)).NotTo(HaveOccurred())
+		}
+		identities = []*utils.QueryIdentity{}
+
+		testFailed = testFailed || CurrentGinkgoTestDescription().Failed
+		if testFailed {
+			utils.PrintMCOObject(testOptions)
+			utils.PrintAllMCOPodsStatus(testOptions)
+			utils.PrintAllOBAPodsStatus(testOptions)
+		} else {
+			Expect(utils.IntegrityChecking(testOptions)).NotTo(HaveOccurred())
+		}
+	})
+})
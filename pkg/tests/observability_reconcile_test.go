@@ -90,25 +90,12 @@ var _ = Describe("Observability:", func() {
 		}, EventuallyTimeoutMinute*10, EventuallyIntervalSecond*5).Should(Succeed())
 	})
 
-	It("[P2][Sev2][Observability][Stable] Checking node selector for all pods (reconcile/g0)", func() {
-		By("Checking node selector for all pods")
-		Eventually(func() error {
-			err = utils.CheckAllPodNodeSelector(testOptions)
-			if err != nil {
-				return err
-			}
-			return nil
-		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(Succeed())
-	})
-
-	It("[P2][Sev2][Observability][Stable] Checking podAntiAffinity for all pods (reconcile/g0)", func() {
-		By("Checking podAntiAffinity for all pods")
+	It("[P2][Sev2][Observability][Stable] Checking scheduling for all pods (reconcile/g0)", func() {
+		By("Checking node selector, tolerations and podAntiAffinity for all pods")
+		expectations, err := utils.GetSchedulingExpectations(testOptions)
+		Expect(err).ToNot(HaveOccurred())
 		Eventually(func() error {
-			err := utils.CheckAllPodsAffinity(testOptions)
-			if err != nil {
-				return err
-			}
-			return nil
+			return utils.CheckPodScheduling(testOptions, expectations)
 		}, EventuallyTimeoutMinute*5, EventuallyIntervalSecond*5).Should(Succeed())
 	})
 
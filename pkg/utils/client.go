@@ -4,10 +4,59 @@
 package utils
 
 import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
+// HTTPAuth sets the credentials of the requests sent to the hub endpoints
+type HTTPAuth interface {
+	Apply(req *http.Request)
+}
+
+// BearerTokenAuth authenticates the requests with a bearer token
+type BearerTokenAuth string
+
+func (t BearerTokenAuth) Apply(req *http.Request) {
+	if t != "" {
+		req.Header.Set("Authorization", "Bearer "+string(t))
+	}
+}
+
+// HeaderAuth authenticates the requests with a custom header, e.g. X-Forwarded-User
+type HeaderAuth struct {
+	Name  string
+	Value string
+}
+
+func (h HeaderAuth) Apply(req *http.Request) {
+	req.Header.Set(h.Name, h.Value)
+}
+
+// BasicAuth authenticates the requests with a username and a password
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (b BasicAuth) Apply(req *http.Request) {
+	req.SetBasicAuth(b.Username, b.Password)
+}
+
+// newHTTPClient returns the client used to access the hub routes, which are usually
+// served with self-signed certificates in the testing environments
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		Timeout: 60 * time.Second,
+	}
+}
+
 func getKubeClient(opt TestOptions, isHub bool) kubernetes.Interface {
 	clientKube := NewKubeClient(
 		opt.HubCluster.MasterURL,
@@ -24,15 +73,16 @@ func getKubeClient(opt TestOptions, isHub bool) kubernetes.Interface {
 	return clientKube
 }
 
-func GetKubeClientDynamic(opt TestOptions, isHub bool) dynamic.Interface {
-	url := opt.HubCluster.MasterURL
-	kubeConfig := opt.KubeConfig
-	kubeContext := opt.HubCluster.KubeContext
+// getClusterAccess returns the url, kubeconfig and context of the hub or the first managed cluster
+func getClusterAccess(opt TestOptions, isHub bool) (string, string, string) {
 	if !isHub && len(opt.ManagedClusters) > 0 {
-		url = opt.ManagedClusters[0].MasterURL
-		kubeConfig = opt.ManagedClusters[0].KubeConfig
-		kubeContext = ""
+		return opt.ManagedClusters[0].MasterURL, opt.ManagedClusters[0].KubeConfig, ""
 	}
+	return opt.HubCluster.MasterURL, opt.KubeConfig, opt.HubCluster.KubeContext
+}
+
+func GetKubeClientDynamic(opt TestOptions, isHub bool) dynamic.Interface {
+	url, kubeConfig, kubeContext := getClusterAccess(opt, isHub)
 
 	config, err := LoadConfig(url, kubeConfig, kubeContext)
 	if err != nil {
@@ -0,0 +1,277 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+const (
+	AlertInactive = "inactive"
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+	// DefaultAlertStaleAfter is how old the latest ALERTS sample of an alert may be for the
+	// alert to be considered active
+	DefaultAlertStaleAfter = 2 * time.Minute
+)
+
+var alertStateOrder = map[string]int{AlertInactive: 0, AlertPending: 1, AlertFiring: 2}
+
+// AlertLifecycle records when an alert is first seen in each state. The pending and firing times
+// are both measured on the ruler replica of the tracker, the replicas evaluate the rules independently
+type AlertLifecycle struct {
+	// For is the for duration of the alerting rule and Interval the evaluation interval of
+	// its group, as reported by the ruler
+	For      time.Duration
+	Interval time.Duration
+	// PendingAt is the time the ruler reports the alert active since, it follows the ruler
+	// until the alert fires, e.g. when the ruler is restarted
+	PendingAt time.Time
+	FiringAt  time.Time
+	// ReceivedAt is when alertmanager first lists the alert
+	ReceivedAt time.Time
+	// ResolvedAt is when the alert is first seen inactive after firing, it is reset
+	// if the alert fires again
+	ResolvedAt time.Time
+	// FiredUnobserved tells the alert was firing when it was first observed active, FiringAt is
+	// then when the tracker saw it firing rather than when it fired
+	FiredUnobserved bool
+}
+
+func (l AlertLifecycle) String() string {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("for %s, interval %s, pending at %s, firing at %s, received by alertmanager at %s, resolved at %s",
+		l.For, l.Interval, format(l.PendingAt), format(l.FiringAt), format(l.ReceivedAt), format(l.ResolvedAt))
+}
+
+// AlertTracker follows the alert with the labels through the ALERTS series, a thanos ruler replica
+// and alertmanager. Observe is expected to be called periodically, e.g. in Eventually
+type AlertTracker struct {
+	Labels map[string]string
+	// Ruler is the thanos ruler pod the pending and firing transitions are measured on
+	Ruler string
+	// StaleAfter defaults to DefaultAlertStaleAfter
+	StaleAfter time.Duration
+	Lifecycle  AlertLifecycle
+	State      string
+
+	// rulerState is the state of the alert last reported by the ruler
+	rulerState string
+	opt        TestOptions
+	query      *PrometheusClient
+}
+
+// NewAlertTracker returns the tracker of the alert with the labels, which usually include the alertname
+func NewAlertTracker(opt TestOptions, labels map[string]string) (*AlertTracker, error) {
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &AlertTracker{
+		Labels:     labels,
+		Ruler:      MCO_CR_NAME + "-thanos-rule-0",
+		StaleAfter: DefaultAlertStaleAfter,
+		State:      AlertInactive,
+		rulerState: AlertInactive,
+		opt:        opt,
+		query:      client,
+	}, nil
+}
+
+// Observe reads the state of the alert from the ALERTS series, the ruler of the tracker and
+// alertmanager, and records the transitions in the lifecycle
+func (t *AlertTracker) Observe() (string, error) {
+	query, err := BuildQuery(Func("timestamp", Metric("ALERTS").Labels(t.Labels)))
+	if err != nil {
+		return "", err
+	}
+	series, err := t.query.QueryVector(query)
+	if err != nil {
+		return "", err
+	}
+
+	pod := t.Ruler
+	port, stop, err := PortForward(t.opt, true, MCO_NAMESPACE, pod, ThanosRuleHTTPPort)
+	if err != nil {
+		return "", err
+	}
+	defer stop()
+	ruler := &PrometheusClient{URL: fmt.Sprintf("http://127.0.0.1:%d", port)}
+	groups, err := ruler.Rules()
+	if err != nil {
+		return "", fmt.Errorf("failed to get rules from %s: %v", pod, err)
+	}
+
+	alertmanager, stopAlertmanager, err := NewAlertmanagerClient(t.opt)
+	if err != nil {
+		return "", err
+	}
+	defer stopAlertmanager()
+	alerts, err := alertmanager.Alerts(AlertFilter{Matchers: labelMatchers(t.Labels)})
+	if err != nil {
+		return "", err
+	}
+
+	t.update(time.Now(), series, groups, alerts)
+	klog.V(1).Infof("alert %v is %s: %s", t.Labels, t.State, t.Lifecycle)
+	return t.State, nil
+}
+
+// update records the state of the alert observed at now. The state is the most advanced one
+// reported by the fresh ALERTS series of every replica and the ruler, the pending and firing
+// transitions are taken from the ruler only
+func (t *AlertTracker) update(now time.Time, series model.Vector, groups []RuleGroupStatus, alerts []Alert) {
+	staleAfter := t.StaleAfter
+	if staleAfter == 0 {
+		staleAfter = DefaultAlertStaleAfter
+	}
+	advance := func(state *string, s string) {
+		if alertStateOrder[s] > alertStateOrder[*state] {
+			*state = s
+		}
+	}
+
+	rulerState := AlertInactive
+	var activeAt *time.Time
+	for _, group := range groups {
+		for _, rule := range group.Rules {
+			if rule.Type != "alerting" {
+				continue
+			}
+			matched := rule.Name == t.Labels["alertname"]
+			for _, alert := range rule.Alerts {
+				if !matchLabels(alert.Labels, t.Labels) {
+					continue
+				}
+				matched = true
+				advance(&rulerState, alert.State)
+				if alert.ActiveAt != nil && (activeAt == nil || alert.ActiveAt.Before(*activeAt)) {
+					activeAt = alert.ActiveAt
+				}
+			}
+			if matched {
+				t.Lifecycle.For = time.Duration(rule.Duration * float64(time.Second))
+				t.Lifecycle.Interval = time.Duration(group.Interval * float64(time.Second))
+			}
+		}
+	}
+
+	state := rulerState
+	for _, sample := range series {
+		ts := time.Unix(0, int64(float64(sample.Value)*float64(time.Second)))
+		if now.Sub(ts) <= staleAfter {
+			advance(&state, string(sample.Metric["alertstate"]))
+		}
+	}
+
+	if rulerState != AlertInactive {
+		if !t.Lifecycle.ResolvedAt.IsZero() {
+			// the alert is active again, its new lifecycle is recorded
+			t.Lifecycle.PendingAt, t.Lifecycle.FiringAt, t.Lifecycle.ResolvedAt = time.Time{}, time.Time{}, time.Time{}
+			t.Lifecycle.FiredUnobserved = false
+		}
+		if t.Lifecycle.FiringAt.IsZero() {
+			t.Lifecycle.PendingAt = now
+			if activeAt != nil {
+				t.Lifecycle.PendingAt = *activeAt
+			}
+		}
+	}
+	if rulerState == AlertFiring && t.Lifecycle.FiringAt.IsZero() {
+		t.Lifecycle.FiringAt = now
+		t.Lifecycle.FiredUnobserved = t.rulerState != AlertPending
+	}
+	if state == AlertInactive && !t.Lifecycle.FiringAt.IsZero() && t.Lifecycle.ResolvedAt.IsZero() {
+		t.Lifecycle.ResolvedAt = now
+	}
+	if len(alerts) > 0 && t.Lifecycle.ReceivedAt.IsZero() {
+		t.Lifecycle.ReceivedAt = now
+	}
+	t.rulerState = rulerState
+	t.State = state
+}
+
+// matchLabels tells whether the labels include every expected label
+func matchLabels(labels, expected map[string]string) bool {
+	for name, value := range expected {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Await observes the alert and fails unless the lifecycle has reached the state, it is meant
+// to be polled with Eventually
+func (t *AlertTracker) Await(state string) error {
+	current, err := t.Observe()
+	if err != nil {
+		return err
+	}
+	reached := map[string]bool{
+		AlertPending:  !t.Lifecycle.PendingAt.IsZero(),
+		AlertFiring:   !t.Lifecycle.FiringAt.IsZero(),
+		AlertResolved: !t.Lifecycle.ResolvedAt.IsZero(),
+	}
+	if !reached[state] {
+		return fmt.Errorf("alert %v is %s, waiting for it to be %s", t.Labels, current, state)
+	}
+	return nil
+}
+
+// CheckAlertLifecycle checks the alert has been pending for the for duration of its rule before
+// firing, and has reached alertmanager. The alert fires at the first evaluation after the for
+// duration, and the transitions are observed every step, which the bounds allow for. The check
+// fails if the tracker has not observed the alert pending before it fired
+func CheckAlertLifecycle(lifecycle AlertLifecycle, step time.Duration) error {
+	if lifecycle.FiringAt.IsZero() {
+		return fmt.Errorf("alert never fired: %s", lifecycle)
+	}
+	errs := []error{}
+	if lifecycle.For > 0 {
+		if lifecycle.PendingAt.IsZero() {
+			errs = append(errs, fmt.Errorf("alert fired without being pending"))
+		} else if lifecycle.FiredUnobserved {
+			errs = append(errs, fmt.Errorf("alert was firing when first observed, the time it fired is unknown"))
+		} else {
+			pendingFor := lifecycle.FiringAt.Sub(lifecycle.PendingAt)
+			if pendingFor < lifecycle.For-step {
+				errs = append(errs, fmt.Errorf("alert fired after being pending for %s, shorter than for %s", pendingFor, lifecycle.For))
+			}
+			if max := lifecycle.For + lifecycle.Interval + step; pendingFor > max {
+				errs = append(errs, fmt.Errorf("alert fired after being pending for %s, longer than %s", pendingFor, max))
+			}
+		}
+	}
+	if lifecycle.ReceivedAt.IsZero() {
+		errs = append(errs, fmt.Errorf("alert never reached alertmanager"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v: %s", utilerrors.NewAggregate(errs), lifecycle)
+	}
+	return nil
+}
+
+// CheckAlertResolved checks the alert has been resolved within the duration after since, e.g. the
+// time its rule is removed or fixed
+func CheckAlertResolved(lifecycle AlertLifecycle, since time.Time, within time.Duration) error {
+	if lifecycle.ResolvedAt.IsZero() {
+		return fmt.Errorf("alert not resolved: %s", lifecycle)
+	}
+	if took := lifecycle.ResolvedAt.Sub(since); took > within {
+		return fmt.Errorf("alert resolved %s after %s, longer than %s", took, since.Format(time.RFC3339), within)
+	}
+	return nil
+}
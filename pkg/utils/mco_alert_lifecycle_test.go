@@ -0,0 +1,142 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAlertsSeries(state string, ts time.Time) model.Vector {
+	return model.Vector{{
+		Metric: model.Metric{"alertname": "NodeOutOfMemory", "alertstate": model.LabelValue(state), "cluster": "local-cluster"},
+		Value:  model.SampleValue(float64(ts.UnixNano()) / float64(time.Second)),
+	}}
+}
+
+func newRuleGroups(state string, activeAt time.Time) []RuleGroupStatus {
+	rule := RuleStatus{Name: "NodeOutOfMemory", Type: "alerting", Health: "ok", Duration: 60}
+	if state != AlertInactive {
+		rule.Alerts = []RuleAlert{{
+			Labels:   map[string]string{"alertname": "NodeOutOfMemory", "cluster": "local-cluster", "severity": "warning"},
+			State:    state,
+			ActiveAt: &activeAt,
+		}}
+	}
+	return []RuleGroupStatus{{Name: "node-health", Interval: 30, Rules: []RuleStatus{rule}}}
+}
+
+func TestAlertTrackerUpdate(t *testing.T) {
+	start := time.Unix(1617000000, 0)
+	tracker := &AlertTracker{Labels: map[string]string{"alertname": "NodeOutOfMemory", "cluster": "local-cluster"}}
+	amAlerts := []Alert{{Labels: map[string]string{"alertname": "NodeOutOfMemory"}}}
+
+	tracker.update(start, nil, newRuleGroups(AlertInactive, time.Time{}), nil)
+	assert.Equal(t, AlertInactive, tracker.State)
+	assert.Equal(t, time.Minute, tracker.Lifecycle.For, "the for duration is known before the alert is active")
+	assert.Equal(t, 30*time.Second, tracker.Lifecycle.Interval)
+
+	activeAt := start.Add(5 * time.Second)
+	tracker.update(start.Add(10*time.Second), newAlertsSeries(AlertPending, activeAt), newRuleGroups(AlertPending, activeAt), nil)
+	assert.Equal(t, AlertPending, tracker.State)
+	assert.Equal(t, activeAt, tracker.Lifecycle.PendingAt, "the ruler tells when the alert became pending")
+	assert.Error(t, CheckAlertLifecycle(tracker.Lifecycle, 10*time.Second))
+
+	// the ruler is restarted by the rollout, the alert is pending again on the new pod
+	activeAt = start.Add(30 * time.Second)
+	tracker.update(start.Add(40*time.Second), newAlertsSeries(AlertPending, activeAt), newRuleGroups(AlertPending, activeAt), nil)
+	assert.Equal(t, activeAt, tracker.Lifecycle.PendingAt, "the pending time follows the ruler until the alert fires")
+
+	// the ALERTS series of another replica is ahead of the ruler of the tracker
+	tracker.update(start.Add(80*time.Second), newAlertsSeries(AlertFiring, start.Add(80*time.Second)), newRuleGroups(AlertPending, activeAt), amAlerts)
+	assert.Equal(t, AlertFiring, tracker.State)
+	assert.True(t, tracker.Lifecycle.FiringAt.IsZero(), "the firing time is taken from the ruler only")
+	assert.Equal(t, start.Add(80*time.Second), tracker.Lifecycle.ReceivedAt)
+
+	firingAt := start.Add(100 * time.Second)
+	tracker.update(firingAt, newAlertsSeries(AlertFiring, firingAt), newRuleGroups(AlertFiring, activeAt), amAlerts)
+	assert.Equal(t, AlertFiring, tracker.State)
+	assert.Equal(t, firingAt, tracker.Lifecycle.FiringAt)
+	assert.Equal(t, activeAt, tracker.Lifecycle.PendingAt)
+	assert.False(t, tracker.Lifecycle.FiredUnobserved)
+	assert.NoError(t, CheckAlertLifecycle(tracker.Lifecycle, 10*time.Second))
+
+	// the rule is removed, the last ALERTS sample becomes stale
+	removedAt := start.Add(5 * time.Minute)
+	tracker.update(removedAt, newAlertsSeries(AlertFiring, removedAt.Add(-time.Minute)), nil, amAlerts)
+	assert.Equal(t, AlertFiring, tracker.State)
+	resolvedAt := removedAt.Add(2*time.Minute + time.Second)
+	tracker.update(resolvedAt, newAlertsSeries(AlertFiring, removedAt.Add(-time.Minute)), nil, nil)
+	assert.Equal(t, AlertInactive, tracker.State)
+	assert.Equal(t, resolvedAt, tracker.Lifecycle.ResolvedAt)
+	assert.NoError(t, CheckAlertResolved(tracker.Lifecycle, removedAt, 5*time.Minute))
+	assert.Error(t, CheckAlertResolved(tracker.Lifecycle, removedAt, time.Minute))
+
+	// the alert fires again, a new lifecycle is recorded
+	tracker.update(resolvedAt.Add(time.Minute), nil, newRuleGroups(AlertPending, resolvedAt.Add(50*time.Second)), nil)
+	assert.Equal(t, AlertPending, tracker.State)
+	assert.True(t, tracker.Lifecycle.FiringAt.IsZero())
+	assert.True(t, tracker.Lifecycle.ResolvedAt.IsZero())
+	assert.Equal(t, resolvedAt.Add(50*time.Second), tracker.Lifecycle.PendingAt)
+}
+
+func TestAlertTrackerStartedLate(t *testing.T) {
+	start := time.Unix(1617000000, 0)
+	tracker := &AlertTracker{Labels: map[string]string{"alertname": "NodeOutOfMemory", "cluster": "local-cluster"}, State: AlertInactive}
+	amAlerts := []Alert{{Labels: map[string]string{"alertname": "NodeOutOfMemory"}}}
+
+	// the alert became pending at start and fired a minute later, before the tracker started
+	observedAt := start.Add(3 * time.Minute)
+	tracker.update(observedAt, newAlertsSeries(AlertFiring, observedAt), newRuleGroups(AlertFiring, start), amAlerts)
+	assert.Equal(t, AlertFiring, tracker.State)
+	assert.Equal(t, start, tracker.Lifecycle.PendingAt)
+	assert.Equal(t, observedAt, tracker.Lifecycle.FiringAt)
+	assert.True(t, tracker.Lifecycle.FiredUnobserved)
+	err := CheckAlertLifecycle(tracker.Lifecycle, 10*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "alert was firing when first observed")
+	assert.NotContains(t, err.Error(), "longer than", "the pending duration is not checked")
+
+	// the alert fires again after it is resolved, the new lifecycle is observed from pending
+	resolvedAt := observedAt.Add(time.Minute)
+	tracker.update(resolvedAt, nil, nil, nil)
+	pendingAt := resolvedAt.Add(time.Minute)
+	tracker.update(pendingAt, newAlertsSeries(AlertPending, pendingAt), newRuleGroups(AlertPending, pendingAt), nil)
+	assert.False(t, tracker.Lifecycle.FiredUnobserved)
+	firingAt := pendingAt.Add(70 * time.Second)
+	tracker.update(firingAt, newAlertsSeries(AlertFiring, firingAt), newRuleGroups(AlertFiring, pendingAt), amAlerts)
+	assert.False(t, tracker.Lifecycle.FiredUnobserved)
+	assert.NoError(t, CheckAlertLifecycle(tracker.Lifecycle, 10*time.Second))
+}
+
+func TestCheckAlertLifecycle(t *testing.T) {
+	start := time.Unix(1617000000, 0)
+	lifecycle := AlertLifecycle{
+		For:        5 * time.Minute,
+		Interval:   time.Minute,
+		PendingAt:  start,
+		FiringAt:   start.Add(time.Minute),
+		ReceivedAt: start.Add(time.Minute),
+	}
+	err := CheckAlertLifecycle(lifecycle, 10*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shorter than for 5m0s")
+
+	lifecycle.FiringAt = start.Add(10 * time.Minute)
+	err = CheckAlertLifecycle(lifecycle, 10*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "longer than 6m10s")
+
+	lifecycle.FiringAt = start.Add(5*time.Minute + 30*time.Second)
+	assert.NoError(t, CheckAlertLifecycle(lifecycle, 10*time.Second))
+
+	lifecycle.ReceivedAt = time.Time{}
+	assert.EqualError(t, CheckAlertLifecycle(lifecycle, 10*time.Second), "alert never reached alertmanager: "+lifecycle.String())
+	assert.Error(t, CheckAlertLifecycle(AlertLifecycle{}, 10*time.Second))
+	assert.Error(t, CheckAlertResolved(lifecycle, start, time.Hour), "the alert is not resolved")
+}
@@ -0,0 +1,408 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	AlertmanagerConfigSecretName = "alertmanager-config"
+	AlertmanagerConfigSecretKey  = "alertmanager.yaml"
+	// AlertmanagerHTTPPort is the port alertmanager listens on behind the oauth proxy
+	AlertmanagerHTTPPort = 9093
+)
+
+// AlertmanagerClient calls the Alertmanager v2 API, either through the route on the hub
+// or through a port forwarded to an alertmanager pod
+type AlertmanagerClient struct {
+	// URL is the prefix of the /api/v2 endpoints
+	URL        string
+	Auth       HTTPAuth
+	HTTPClient *http.Client
+}
+
+// Matcher matches the label of an alert, as used by silences and inhibition
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+}
+
+// Receiver is a receiver an alert is routed to
+type Receiver struct {
+	Name string `json:"name"`
+}
+
+// AlertStatus tells whether an alert is active, or suppressed by silences or inhibition
+type AlertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
+}
+
+// Alert is an alert as reported by the /api/v2/alerts endpoint
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	Receivers    []Receiver        `json:"receivers"`
+	Status       AlertStatus       `json:"status"`
+}
+
+// ReceiverNames returns the names of the receivers the alert is routed to
+func (a Alert) ReceiverNames() []string {
+	names := []string{}
+	for _, receiver := range a.Receivers {
+		names = append(names, receiver.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AlertFilter selects the alerts returned by the /api/v2/alerts endpoint, the silenced and
+// inhibited alerts are included unless they are excluded explicitly
+type AlertFilter struct {
+	// Matchers are label matchers in the alertmanager syntax, e.g. alertname="Watchdog"
+	Matchers         []string
+	Receiver         string
+	ExcludeSilenced  bool
+	ExcludeInhibited bool
+}
+
+// Silence is a silence as reported by the /api/v2/silences endpoint
+type Silence struct {
+	ID        string    `json:"id,omitempty"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+	Status    *struct {
+		State string `json:"state"`
+	} `json:"status,omitempty"`
+}
+
+// AlertmanagerStatus is the status reported by the /api/v2/status endpoint, the config is the
+// loaded configuration with the secrets masked
+type AlertmanagerStatus struct {
+	Cluster struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Peers  []struct {
+			Name    string `json:"name"`
+			Address string `json:"address"`
+		} `json:"peers"`
+	} `json:"cluster"`
+	Config struct {
+		Original string `json:"original"`
+	} `json:"config"`
+	Uptime      time.Time         `json:"uptime"`
+	VersionInfo map[string]string `json:"versionInfo"`
+}
+
+// alertmanagerRouting summarizes the routing tree and the receivers with their webhook urls, which
+// are not changed by the defaults alertmanager fills in when the configuration is loaded
+func alertmanagerRouting(data []byte) (string, error) {
+	config, err := ParseAlertmanagerConfig(data)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	var walk func(route *Route, depth int)
+	walk = func(route *Route, depth int) {
+		lines = append(lines, fmt.Sprintf("%sroute receiver=%s group_by=%v match=%v match_re=%v continue=%t",
+			strings.Repeat("  ", depth), route.Receiver, route.GroupBy, route.Match, route.MatchRE, route.Continue))
+		for _, child := range route.Routes {
+			walk(child, depth+1)
+		}
+	}
+	if config.Route != nil {
+		walk(config.Route, 0)
+	}
+	receivers := []string{}
+	for _, receiver := range config.Receivers {
+		urls := []string{}
+		for _, webhook := range receiver.WebhookConfigs {
+			urls = append(urls, webhook.URL)
+		}
+		receivers = append(receivers, fmt.Sprintf("receiver %s webhooks=%v", receiver.Name, urls))
+	}
+	sort.Strings(receivers)
+	return strings.Join(append(lines, receivers...), "\n"), nil
+}
+
+// Routing summarizes the routing tree and the receivers of the loaded configuration
+func (s *AlertmanagerStatus) Routing() (string, error) {
+	return alertmanagerRouting([]byte(s.Config.Original))
+}
+
+// do sends the request to the API path, and decodes the response into data if it is not nil
+func (c *AlertmanagerClient) do(method, path string, params url.Values, body, data interface{}) error {
+	reqURL := strings.TrimSuffix(c.URL, "/") + path
+	if len(params) > 0 {
+		reqURL += "?" + params.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	klog.V(5).Infof("request url is: %s %s\n", method, reqURL)
+	req, err := http.NewRequest(method, reqURL, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Auth != nil {
+		c.Auth.Apply(req)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	klog.V(5).Infof("response: %s\n", respBody)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed with status code %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, data); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %v", path, err)
+	}
+	return nil
+}
+
+// Alerts returns the alerts selected by the filter, with the receivers they are routed to
+func (c *AlertmanagerClient) Alerts(filter AlertFilter) ([]Alert, error) {
+	params := url.Values{}
+	for _, matcher := range filter.Matchers {
+		params.Add("filter", matcher)
+	}
+	if filter.Receiver != "" {
+		params.Set("receiver", filter.Receiver)
+	}
+	params.Set("silenced", strconv.FormatBool(!filter.ExcludeSilenced))
+	params.Set("inhibited", strconv.FormatBool(!filter.ExcludeInhibited))
+
+	alerts := []Alert{}
+	if err := c.do("GET", "/api/v2/alerts", params, nil, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// Silences returns the active, pending and expired silences
+func (c *AlertmanagerClient) Silences() ([]Silence, error) {
+	silences := []Silence{}
+	if err := c.do("GET", "/api/v2/silences", nil, nil, &silences); err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+// CreateSilence creates the silence and returns its id
+func (c *AlertmanagerClient) CreateSilence(silence Silence) (string, error) {
+	data := struct {
+		SilenceID string `json:"silenceID"`
+	}{}
+	if err := c.do("POST", "/api/v2/silences", nil, silence, &data); err != nil {
+		return "", err
+	}
+	return data.SilenceID, nil
+}
+
+// ExpireSilence expires the silence, the silence is kept as expired by alertmanager
+func (c *AlertmanagerClient) ExpireSilence(id string) error {
+	return c.do("DELETE", "/api/v2/silence/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Status returns the cluster status and the loaded configuration
+func (c *AlertmanagerClient) Status() (*AlertmanagerStatus, error) {
+	status := &AlertmanagerStatus{}
+	if err := c.do("GET", "/api/v2/status", nil, nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// NewAlertmanagerClient returns the client of the alertmanager on the hub. The route set by
+// alertmanagerURL in the options is accessed with the token of the testing service account,
+// otherwise a port of the first alertmanager pod is forwarded until the returned stop
+// function is called
+func NewAlertmanagerClient(opt TestOptions) (*AlertmanagerClient, func(), error) {
+	if opt.HubCluster.AlertmanagerURL != "" {
+		token, err := FetchBearerToken(opt)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &AlertmanagerClient{
+			URL:        opt.HubCluster.AlertmanagerURL,
+			Auth:       BearerTokenAuth(token),
+			HTTPClient: newHTTPClient(),
+		}, func() {}, nil
+	}
+
+	port, stop, err := PortForward(opt, true, MCO_NAMESPACE, MCO_CR_NAME+"-alertmanager-0", AlertmanagerHTTPPort)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &AlertmanagerClient{
+		URL:        fmt.Sprintf("http://127.0.0.1:%d", port),
+		HTTPClient: newHTTPClient(),
+	}, stop, nil
+}
+
+// NewSilence returns a silence of the alerts with the labels, lasting for the duration
+func NewSilence(labels map[string]string, duration time.Duration, comment string) Silence {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now().UTC()
+	silence := Silence{
+		StartsAt:  now,
+		EndsAt:    now.Add(duration),
+		CreatedBy: "observability-e2e-test",
+		Comment:   comment,
+	}
+	for _, name := range names {
+		silence.Matchers = append(silence.Matchers, Matcher{Name: name, Value: labels[name]})
+	}
+	return silence
+}
+
+// CheckAlertRouted checks an alert with the labels is active in alertmanager and is routed
+// to the receiver
+func CheckAlertRouted(client *AlertmanagerClient, labels map[string]string, receiver string) error {
+	alerts, err := client.Alerts(AlertFilter{Matchers: labelMatchers(labels)})
+	if err != nil {
+		return err
+	}
+	if len(alerts) == 0 {
+		return fmt.Errorf("no alert with labels %v in alertmanager", labels)
+	}
+	for _, alert := range alerts {
+		for _, name := range alert.ReceiverNames() {
+			if name == receiver {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("alert with labels %v is routed to %v instead of %s", labels, alerts[0].ReceiverNames(), receiver)
+}
+
+// CheckAlertSuppressed checks every alert with the labels is suppressed, by the silence if the
+// silence id is set, otherwise by any silence or inhibition
+func CheckAlertSuppressed(client *AlertmanagerClient, labels map[string]string, silenceID string) error {
+	alerts, err := client.Alerts(AlertFilter{Matchers: labelMatchers(labels)})
+	if err != nil {
+		return err
+	}
+	if len(alerts) == 0 {
+		return fmt.Errorf("no alert with labels %v in alertmanager", labels)
+	}
+	for _, alert := range alerts {
+		if alert.Status.State != "suppressed" {
+			return fmt.Errorf("alert %v is %s instead of suppressed", alert.Labels, alert.Status.State)
+		}
+		if silenceID == "" {
+			continue
+		}
+		silenced := false
+		for _, id := range alert.Status.SilencedBy {
+			silenced = silenced || id == silenceID
+		}
+		if !silenced {
+			return fmt.Errorf("alert %v is not silenced by %s but by %v", alert.Labels, silenceID, alert.Status.SilencedBy)
+		}
+	}
+	return nil
+}
+
+// labelMatchers returns the equality matchers of the labels in the alertmanager syntax
+func labelMatchers(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matchers := []string{}
+	for _, name := range names {
+		matchers = append(matchers, name+"="+strconv.Quote(labels[name]))
+	}
+	return matchers
+}
+
+// CheckAlertmanagerConfigReloaded checks alertmanager has loaded the configuration in the
+// alertmanager-config secret, by comparing the routing tree and the receivers with their webhook
+// urls of the secret and the loaded config
+func CheckAlertmanagerConfigReloaded(opt TestOptions) error {
+	clientKube := getKubeClient(opt, true)
+	secret, err := clientKube.CoreV1().Secrets(MCO_NAMESPACE).Get(AlertmanagerConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	expected, err := alertmanagerRouting(secret.Data[AlertmanagerConfigSecretKey])
+	if err != nil {
+		return fmt.Errorf("secret %s: %v", AlertmanagerConfigSecretName, err)
+	}
+
+	client, stop, err := NewAlertmanagerClient(opt)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	status, err := client.Status()
+	if err != nil {
+		return err
+	}
+	loaded, err := status.Routing()
+	if err != nil {
+		return err
+	}
+
+	if loaded != expected {
+		return fmt.Errorf("alertmanager has loaded the routing:\n%s\ninstead of the routing in secret %s:\n%s",
+			loaded, AlertmanagerConfigSecretName, expected)
+	}
+	klog.V(1).Infof("alertmanager has loaded the routing:\n%s", loaded)
+	return nil
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+// AlertmanagerConfig is the alertmanager.yaml of the alertmanager-config secret, limited to the
+// settings used by the tests
+type AlertmanagerConfig struct {
+	Global       *GlobalConfig    `json:"global,omitempty"`
+	Route        *Route           `json:"route,omitempty"`
+	Receivers    []ReceiverConfig `json:"receivers,omitempty"`
+	InhibitRules []InhibitRule    `json:"inhibit_rules,omitempty"`
+	Templates    []string         `json:"templates,omitempty"`
+}
+
+// GlobalConfig holds the defaults of the receivers
+type GlobalConfig struct {
+	ResolveTimeout string `json:"resolve_timeout,omitempty"`
+	SMTPFrom       string `json:"smtp_from,omitempty"`
+	SMTPSmarthost  string `json:"smtp_smarthost,omitempty"`
+	SlackAPIURL    string `json:"slack_api_url,omitempty"`
+	PagerdutyURL   string `json:"pagerduty_url,omitempty"`
+}
+
+// Route is a node of the routing tree, the alerts matching the route are sent to its receiver
+// unless they match one of its child routes
+type Route struct {
+	Receiver       string            `json:"receiver,omitempty"`
+	GroupBy        []string          `json:"group_by,omitempty"`
+	Match          map[string]string `json:"match,omitempty"`
+	MatchRE        map[string]string `json:"match_re,omitempty"`
+	Continue       bool              `json:"continue,omitempty"`
+	GroupWait      string            `json:"group_wait,omitempty"`
+	GroupInterval  string            `json:"group_interval,omitempty"`
+	RepeatInterval string            `json:"repeat_interval,omitempty"`
+	Routes         []*Route          `json:"routes,omitempty"`
+}
+
+// ReceiverConfig is a named receiver with its integrations
+type ReceiverConfig struct {
+	Name             string            `json:"name"`
+	WebhookConfigs   []WebhookConfig   `json:"webhook_configs,omitempty"`
+	SlackConfigs     []SlackConfig     `json:"slack_configs,omitempty"`
+	PagerdutyConfigs []PagerdutyConfig `json:"pagerduty_configs,omitempty"`
+	EmailConfigs     []EmailConfig     `json:"email_configs,omitempty"`
+}
+
+type WebhookConfig struct {
+	URL          string `json:"url"`
+	SendResolved bool   `json:"send_resolved"`
+	MaxAlerts    int    `json:"max_alerts,omitempty"`
+}
+
+type SlackConfig struct {
+	APIURL       string `json:"api_url,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Text         string `json:"text,omitempty"`
+	SendResolved bool   `json:"send_resolved"`
+}
+
+type PagerdutyConfig struct {
+	RoutingKey   string `json:"routing_key,omitempty"`
+	ServiceKey   string `json:"service_key,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Severity     string `json:"severity,omitempty"`
+	SendResolved bool   `json:"send_resolved"`
+}
+
+type EmailConfig struct {
+	To           string `json:"to"`
+	From         string `json:"from,omitempty"`
+	Smarthost    string `json:"smarthost,omitempty"`
+	SendResolved bool   `json:"send_resolved"`
+}
+
+// InhibitRule mutes the alerts matching the target while an alert matching the source fires,
+// if both have the same values of the equal labels
+type InhibitRule struct {
+	SourceMatch   map[string]string `json:"source_match,omitempty"`
+	SourceMatchRE map[string]string `json:"source_match_re,omitempty"`
+	TargetMatch   map[string]string `json:"target_match,omitempty"`
+	TargetMatchRE map[string]string `json:"target_match_re,omitempty"`
+	Equal         []string          `json:"equal,omitempty"`
+}
+
+// ParseAlertmanagerConfig parses the alertmanager.yaml, the unknown settings are ignored
+func ParseAlertmanagerConfig(data []byte) (*AlertmanagerConfig, error) {
+	config := &AlertmanagerConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse alertmanager config: %v", err)
+	}
+	return config, nil
+}
+
+// Validate reports the problems alertmanager would reject the configuration for: duplicate
+// receivers, routes referring to unknown receivers, invalid matchers and durations
+func (c *AlertmanagerConfig) Validate() error {
+	errs := []error{}
+	if c.Global != nil && c.Global.ResolveTimeout != "" {
+		errs = append(errs, validateDuration("global resolve_timeout", c.Global.ResolveTimeout)...)
+	}
+
+	receivers := map[string]bool{}
+	for i, receiver := range c.Receivers {
+		if receiver.Name == "" {
+			errs = append(errs, fmt.Errorf("receiver %d: missing name", i))
+			continue
+		}
+		if receivers[receiver.Name] {
+			errs = append(errs, fmt.Errorf("receiver %s: defined more than once", receiver.Name))
+		}
+		receivers[receiver.Name] = true
+		for _, webhook := range receiver.WebhookConfigs {
+			if u, err := url.Parse(webhook.URL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("receiver %s: invalid webhook url %q", receiver.Name, webhook.URL))
+			}
+		}
+		for _, email := range receiver.EmailConfigs {
+			if email.To == "" {
+				errs = append(errs, fmt.Errorf("receiver %s: missing email to", receiver.Name))
+			}
+		}
+		for _, pagerduty := range receiver.PagerdutyConfigs {
+			if pagerduty.RoutingKey == "" && pagerduty.ServiceKey == "" {
+				errs = append(errs, fmt.Errorf("receiver %s: missing pagerduty routing_key or service_key", receiver.Name))
+			}
+		}
+	}
+
+	if c.Route == nil {
+		errs = append(errs, fmt.Errorf("route: missing"))
+	} else {
+		if c.Route.Receiver == "" {
+			errs = append(errs, fmt.Errorf("route: the root route has no receiver"))
+		}
+		if len(c.Route.Match) > 0 || len(c.Route.MatchRE) > 0 {
+			errs = append(errs, fmt.Errorf("route: the root route must not have matchers"))
+		}
+		errs = append(errs, validateRoute("route", c.Route, receivers)...)
+	}
+
+	for i, rule := range c.InhibitRules {
+		name := fmt.Sprintf("inhibit rule %d", i)
+		errs = append(errs, validateMatchers(name+" source_match", rule.SourceMatch, false)...)
+		errs = append(errs, validateMatchers(name+" source_match_re", rule.SourceMatchRE, true)...)
+		errs = append(errs, validateMatchers(name+" target_match", rule.TargetMatch, false)...)
+		errs = append(errs, validateMatchers(name+" target_match_re", rule.TargetMatchRE, true)...)
+		errs = append(errs, validateLabelNames(name+" equal", rule.Equal)...)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateRoute validates the route and its child routes, path locates the route in the tree
+func validateRoute(path string, route *Route, receivers map[string]bool) []error {
+	errs := []error{}
+	if route.Receiver != "" && !receivers[route.Receiver] {
+		errs = append(errs, fmt.Errorf("%s: unknown receiver %s", path, route.Receiver))
+	}
+	for _, labelName := range route.GroupBy {
+		if labelName != "..." && !model.LabelName(labelName).IsValid() {
+			errs = append(errs, fmt.Errorf("%s group_by: invalid label name %q", path, labelName))
+		}
+	}
+	errs = append(errs, validateMatchers(path+" match", route.Match, false)...)
+	errs = append(errs, validateMatchers(path+" match_re", route.MatchRE, true)...)
+	errs = append(errs, validateDuration(path+" group_wait", route.GroupWait)...)
+	errs = append(errs, validateDuration(path+" group_interval", route.GroupInterval)...)
+	errs = append(errs, validateDuration(path+" repeat_interval", route.RepeatInterval)...)
+	for i, child := range route.Routes {
+		errs = append(errs, validateRoute(fmt.Sprintf("%s.routes[%d]", path, i), child, receivers)...)
+	}
+	return errs
+}
+
+func validateMatchers(path string, matchers map[string]string, isRegex bool) []error {
+	errs := []error{}
+	for name, value := range matchers {
+		if !model.LabelName(name).IsValid() {
+			errs = append(errs, fmt.Errorf("%s: invalid label name %q", path, name))
+		}
+		if isRegex {
+			if _, err := regexp.Compile("^(?:" + value + ")$"); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid regex %q of label %s: %v", path, value, name, err))
+			}
+		}
+	}
+	return errs
+}
+
+func validateLabelNames(path string, names []string) []error {
+	errs := []error{}
+	for _, name := range names {
+		if !model.LabelName(name).IsValid() {
+			errs = append(errs, fmt.Errorf("%s: invalid label name %q", path, name))
+		}
+	}
+	return errs
+}
+
+func validateDuration(path, duration string) []error {
+	if duration == "" {
+		return nil
+	}
+	if _, err := model.ParseDuration(duration); err != nil {
+		return []error{fmt.Errorf("%s: %v", path, err)}
+	}
+	return nil
+}
+
+// Render validates the configuration and renders the alertmanager.yaml
+func (c *AlertmanagerConfig) Render() ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid alertmanager config: %v", err)
+	}
+	return yaml.Marshal(c)
+}
+
+// SecretYaml renders the alertmanager-config secret holding the configuration
+func (c *AlertmanagerConfig) SecretYaml() ([]byte, error) {
+	data, err := c.Render()
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      AlertmanagerConfigSecretName,
+			Namespace: MCO_NAMESPACE,
+		},
+		Data: map[string][]byte{AlertmanagerConfigSecretKey: data},
+	}
+	return yaml.Marshal(secret)
+}
+
+// ApplyAlertmanagerConfig validates the configuration and replaces the alertmanager-config
+// secret of the hub with it
+func ApplyAlertmanagerConfig(opt TestOptions, config *AlertmanagerConfig) error {
+	yamlB, err := config.SecretYaml()
+	if err != nil {
+		return err
+	}
+	return Apply(opt.HubCluster.MasterURL, opt.KubeConfig, opt.HubCluster.KubeContext, yamlB)
+}
+
+// GetAlertmanagerConfigSecret returns the alertmanager-config secret of the hub, which can be
+// restored with RestoreAlertmanagerConfigSecret after the configuration is replaced
+func GetAlertmanagerConfigSecret(opt TestOptions) (*corev1.Secret, error) {
+	clientKube := getKubeClient(opt, true)
+	return clientKube.CoreV1().Secrets(MCO_NAMESPACE).Get(AlertmanagerConfigSecretName, metav1.GetOptions{})
+}
+
+// RestoreAlertmanagerConfigSecret restores the data of the alertmanager-config secret of the hub
+// from the saved secret
+func RestoreAlertmanagerConfigSecret(opt TestOptions, saved *corev1.Secret) error {
+	clientKube := getKubeClient(opt, true)
+	secret, err := clientKube.CoreV1().Secrets(MCO_NAMESPACE).Get(AlertmanagerConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	secret.Data = saved.Data
+	_, err = clientKube.CoreV1().Secrets(MCO_NAMESPACE).Update(secret)
+	if err == nil {
+		klog.V(1).Infof("secret %s restored", AlertmanagerConfigSecretName)
+	}
+	return err
+}
+
+// NewWebhookAlertConfig returns the configuration routing every alert to the webhook
+// receiver at webhookURL, with short group intervals to deliver the alerts quickly
+func NewWebhookAlertConfig(webhookURL string) *AlertmanagerConfig {
+	return &AlertmanagerConfig{
+		Global: &GlobalConfig{ResolveTimeout: "5m"},
+		Route: &Route{
+			Receiver: "default-receiver",
+			Routes: []*Route{
+				{Match: map[string]string{"alertname": "Watchdog"}, Receiver: "default-receiver"},
+			},
+			GroupBy:        []string{"alertname", "cluster"},
+			GroupWait:      "5s",
+			GroupInterval:  "5s",
+			RepeatInterval: "2m",
+		},
+		Receivers: []ReceiverConfig{
+			{
+				Name:           "default-receiver",
+				WebhookConfigs: []WebhookConfig{{URL: webhookURL, SendResolved: true}},
+			},
+		},
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAlertmanagerConfigRender(t *testing.T) {
+	config := NewWebhookAlertConfig("http://receiver.svc:8080/cgi-bin/record")
+	config.Receivers = append(config.Receivers,
+		ReceiverConfig{Name: "oncall", PagerdutyConfigs: []PagerdutyConfig{{RoutingKey: "key", SendResolved: true}}},
+		ReceiverConfig{Name: "team", SlackConfigs: []SlackConfig{{APIURL: "https://slack.example.com", Channel: "#team"}}},
+	)
+	config.Route.Routes = append(config.Route.Routes, &Route{
+		Receiver: "oncall",
+		MatchRE:  map[string]string{"severity": "critical|warning"},
+		Routes:   []*Route{{Receiver: "team", Match: map[string]string{"team": "observability"}, Continue: true}},
+	})
+	config.InhibitRules = []InhibitRule{{
+		SourceMatch: map[string]string{"severity": "critical"},
+		TargetMatch: map[string]string{"severity": "warning"},
+		Equal:       []string{"alertname", "cluster"},
+	}}
+
+	data, err := config.Render()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "send_resolved: true")
+	assert.Contains(t, string(data), "match_re:")
+
+	parsed, err := ParseAlertmanagerConfig(data)
+	require.NoError(t, err)
+	assert.Equal(t, config, parsed)
+
+	yamlB, err := CreateCustomAlertConfigYaml("http://receiver.svc:8080/cgi-bin/record")
+	require.NoError(t, err)
+	secret := &corev1.Secret{}
+	require.NoError(t, yaml.Unmarshal(yamlB, secret))
+	assert.Equal(t, AlertmanagerConfigSecretName, secret.Name)
+	assert.Equal(t, MCO_NAMESPACE, secret.Namespace)
+	parsed, err = ParseAlertmanagerConfig(secret.Data[AlertmanagerConfigSecretKey])
+	require.NoError(t, err)
+	assert.Equal(t, "http://receiver.svc:8080/cgi-bin/record", parsed.Receivers[0].WebhookConfigs[0].URL)
+}
+
+func TestAlertmanagerConfigValidate(t *testing.T) {
+	config := &AlertmanagerConfig{
+		Global: &GlobalConfig{ResolveTimeout: "5 minutes"},
+		Route: &Route{
+			Receiver:  "default-receiver",
+			GroupBy:   []string{"alertname", "cluster-name"},
+			GroupWait: "5s",
+			Routes: []*Route{
+				{Receiver: "missing", Match: map[string]string{"alertname": "Watchdog"}},
+				{Receiver: "default-receiver", MatchRE: map[string]string{"severity": "critical|("}},
+			},
+		},
+		Receivers: []ReceiverConfig{
+			{Name: "default-receiver", WebhookConfigs: []WebhookConfig{{URL: "receiver.svc"}}},
+			{Name: "default-receiver"},
+			{Name: "mail", EmailConfigs: []EmailConfig{{}}},
+		},
+		InhibitRules: []InhibitRule{{SourceMatch: map[string]string{"0severity": "critical"}}},
+	}
+
+	err := config.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{
+		`global resolve_timeout: not a valid duration string: "5 minutes"`,
+		"receiver default-receiver: defined more than once",
+		`receiver default-receiver: invalid webhook url "receiver.svc"`,
+		"receiver mail: missing email to",
+		`route group_by: invalid label name "cluster-name"`,
+		"route.routes[0]: unknown receiver missing",
+		`route.routes[1] match_re: invalid regex "critical|(" of label severity`,
+		`inhibit rule 0 source_match: invalid label name "0severity"`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+	_, err = config.Render()
+	assert.Error(t, err, "an invalid config is not rendered")
+
+	assert.EqualError(t, (&AlertmanagerConfig{Receivers: []ReceiverConfig{{Name: "default-receiver"}}}).Validate(), "route: missing")
+	assert.NoError(t, NewWebhookAlertConfig("http://receiver.svc").Validate())
+}
+
+func TestAlertmanagerRouting(t *testing.T) {
+	data, err := NewWebhookAlertConfig("http://receiver.svc:8080/cgi-bin/record").Render()
+	require.NoError(t, err)
+	expected, err := alertmanagerRouting(data)
+	require.NoError(t, err)
+
+	// the loaded config has the defaults filled in by alertmanager
+	loaded := `global:
+  resolve_timeout: 5m
+  http_config: {}
+route:
+  receiver: default-receiver
+  group_by:
+  - alertname
+  - cluster
+  routes:
+  - receiver: default-receiver
+    match:
+      alertname: Watchdog
+  group_wait: 5s
+  group_interval: 5s
+  repeat_interval: 2m
+receivers:
+- name: default-receiver
+  webhook_configs:
+  - send_resolved: true
+    http_config: {}
+    url: http://receiver.svc:8080/cgi-bin/record
+    max_alerts: 0
+templates: []
+`
+	routing, err := alertmanagerRouting([]byte(loaded))
+	require.NoError(t, err)
+	assert.Equal(t, expected, routing)
+
+	// same receiver names with another webhook url or route
+	data, err = NewWebhookAlertConfig("http://other.svc:8080/cgi-bin/record").Render()
+	require.NoError(t, err)
+	routing, err = alertmanagerRouting(data)
+	require.NoError(t, err)
+	assert.NotEqual(t, expected, routing)
+
+	config := NewWebhookAlertConfig("http://receiver.svc:8080/cgi-bin/record")
+	config.Route.Routes[0].Match["alertname"] = "NodeDown"
+	data, err = config.Render()
+	require.NoError(t, err)
+	routing, err = alertmanagerRouting(data)
+	require.NoError(t, err)
+	assert.NotEqual(t, expected, routing)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeAlertmanager serves the alerts, silences and status of the Alertmanager v2 API
+func newFakeAlertmanager(t *testing.T, silences map[string]Silence) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v2/alerts":
+			assert.Equal(t, []string{`alertname="NodeDown"`, `cluster="local-cluster"`}, r.URL.Query()["filter"])
+			assert.Equal(t, "true", r.URL.Query().Get("silenced"))
+			state, silencedBy := "active", "[]"
+			for id := range silences {
+				state, silencedBy = "suppressed", fmt.Sprintf("[%q]", id)
+			}
+			fmt.Fprintf(w, `[{"labels":{"alertname":"NodeDown","cluster":"local-cluster"},"annotations":{"summary":"node down"},
+				"startsAt":"2021-04-01T00:00:00Z","endsAt":"2021-04-01T00:05:00Z","updatedAt":"2021-04-01T00:00:30Z",
+				"fingerprint":"a1b2","receivers":[{"name":"webhook"}],
+				"status":{"state":%q,"silencedBy":%s,"inhibitedBy":[]}}]`, state, silencedBy)
+		case r.Method == "POST" && r.URL.Path == "/api/v2/silences":
+			silence := Silence{}
+			if err := json.NewDecoder(r.Body).Decode(&silence); !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			silences["s1"] = silence
+			fmt.Fprint(w, `{"silenceID":"s1"}`)
+		case r.Method == "DELETE" && r.URL.Path == "/api/v2/silence/s1":
+			if _, ok := silences["s1"]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, "silence not found")
+				return
+			}
+			delete(silences, "s1")
+		case r.Method == "GET" && r.URL.Path == "/api/v2/status":
+			fmt.Fprint(w, `{"cluster":{"name":"01F","status":"ready","peers":[{"name":"01F","address":"10.0.0.1:9094"}]},
+				"config":{"original":"global:\n  resolve_timeout: 5m\nroute:\n  receiver: webhook\nreceivers:\n- name: webhook\n- name: default-receiver\n"},
+				"uptime":"2021-04-01T00:00:00Z","versionInfo":{"version":"0.21.0"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestAlertmanagerClient(t *testing.T) {
+	silences := map[string]Silence{}
+	server := newFakeAlertmanager(t, silences)
+	defer server.Close()
+	client := &AlertmanagerClient{URL: server.URL}
+	labels := map[string]string{"alertname": "NodeDown", "cluster": "local-cluster"}
+
+	alerts, err := client.Alerts(AlertFilter{Matchers: labelMatchers(labels)})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, []string{"webhook"}, alerts[0].ReceiverNames())
+	assert.Equal(t, "node down", alerts[0].Annotations["summary"])
+	assert.Equal(t, 5*time.Minute, alerts[0].EndsAt.Sub(alerts[0].StartsAt))
+	assert.NoError(t, CheckAlertRouted(client, labels, "webhook"))
+	assert.Error(t, CheckAlertRouted(client, labels, "default-receiver"))
+	assert.Error(t, CheckAlertSuppressed(client, labels, ""))
+
+	id, err := client.CreateSilence(NewSilence(labels, time.Hour, "testing"))
+	require.NoError(t, err)
+	assert.Equal(t, "s1", id)
+	require.Len(t, silences["s1"].Matchers, 2)
+	assert.Equal(t, Matcher{Name: "alertname", Value: "NodeDown"}, silences["s1"].Matchers[0])
+	assert.Equal(t, time.Hour, silences["s1"].EndsAt.Sub(silences["s1"].StartsAt))
+	assert.NoError(t, CheckAlertSuppressed(client, labels, id))
+	assert.Error(t, CheckAlertSuppressed(client, labels, "s2"))
+
+	require.NoError(t, client.ExpireSilence(id))
+	assert.Empty(t, silences)
+	assert.Error(t, client.ExpireSilence(id), "the silence is expired already")
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	assert.Equal(t, "ready", status.Cluster.Status)
+	assert.Len(t, status.Cluster.Peers, 1)
+	routing, err := status.Routing()
+	require.NoError(t, err)
+	assert.Equal(t, "route receiver=webhook group_by=[] match=map[] match_re=map[] continue=false\n"+
+		"receiver default-receiver webhooks=[]\nreceiver webhook webhooks=[]", routing)
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+)
+
+const (
+	AllowlistConfigMapName       = "observability-metrics-allowlist"
+	CustomAllowlistConfigMapName = "observability-metrics-custom-allowlist"
+	AllowlistConfigMapKey        = "metrics_list.yaml"
+)
+
+// DefaultAllowlistIgnores are the metrics generated on the hub or written by the tests instead of
+// being collected, the series recorded by the thanos ruler are ignored as well
+var DefaultAllowlistIgnores = []string{"ALERTS", "ALERTS_FOR_STATE", RemoteWriteProbeMetric}
+
+// MetricsAllowlist is the content of the metrics allowlist configmaps
+type MetricsAllowlist struct {
+	Names          []string          `json:"names,omitempty"`
+	Matches        []string          `json:"matches,omitempty"`
+	Renames        map[string]string `json:"renames,omitempty"`
+	RecordingRules []RecordingRule   `json:"recording_rules,omitempty"`
+}
+
+// RecordingRule is a rule evaluated by the metrics collector before the series are sent to the hub
+type RecordingRule struct {
+	Record string `json:"record"`
+	Expr   string `json:"expr"`
+}
+
+// AllowlistReport is the result of the allowlist verification of one managed cluster
+type AllowlistReport struct {
+	Cluster string
+	// Missing are the allowlisted metrics not found on the hub
+	Missing []string
+	// Unexpected are the metrics found on the hub which are not allowlisted
+	Unexpected []string
+}
+
+func (r AllowlistReport) String() string {
+	return fmt.Sprintf("cluster %s: missing %v, not allowlisted %v", r.Cluster, r.Missing, r.Unexpected)
+}
+
+// ParseMetricsAllowlist parses the metrics_list.yaml of an allowlist configmap
+func ParseMetricsAllowlist(data []byte) (*MetricsAllowlist, error) {
+	allowlist := &MetricsAllowlist{}
+	if err := yaml.Unmarshal(data, allowlist); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics allowlist: %v", err)
+	}
+	for _, match := range allowlist.Matches {
+		if _, err := parser.ParseMetricSelector("{" + match + "}"); err != nil {
+			return nil, fmt.Errorf("invalid match %s in metrics allowlist: %v", match, err)
+		}
+	}
+	return allowlist, nil
+}
+
+// GetMetricsAllowlist returns the default allowlist merged with the custom allowlist if it exists
+func GetMetricsAllowlist(opt TestOptions) (*MetricsAllowlist, error) {
+	err, cm := GetConfigMap(opt, true, AllowlistConfigMapName, MCO_NAMESPACE)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := ParseMetricsAllowlist([]byte(cm.Data[AllowlistConfigMapKey]))
+	if err != nil {
+		return nil, err
+	}
+
+	err, cm = GetConfigMap(opt, true, CustomAllowlistConfigMapName, MCO_NAMESPACE)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return allowlist, nil
+		}
+		return nil, err
+	}
+	custom, err := ParseMetricsAllowlist([]byte(cm.Data[AllowlistConfigMapKey]))
+	if err != nil {
+		return nil, err
+	}
+	allowlist.Merge(custom)
+	return allowlist, nil
+}
+
+// Merge adds the names, matches, renames and recording rules of the other allowlist
+func (l *MetricsAllowlist) Merge(other *MetricsAllowlist) {
+	l.Names = append(l.Names, other.Names...)
+	l.Matches = append(l.Matches, other.Matches...)
+	l.RecordingRules = append(l.RecordingRules, other.RecordingRules...)
+	if len(other.Renames) > 0 && l.Renames == nil {
+		l.Renames = map[string]string{}
+	}
+	for from, to := range other.Renames {
+		l.Renames[from] = to
+	}
+}
+
+// ExpectedNames returns the metric names expected on the hub: the allowlisted names
+// under their new name if renamed, and the names recorded by the recording rules
+func (l *MetricsAllowlist) ExpectedNames() []string {
+	set := map[string]bool{}
+	for _, name := range l.Names {
+		if to, ok := l.Renames[name]; ok {
+			name = to
+		}
+		set[name] = true
+	}
+	for _, rule := range l.RecordingRules {
+		set[rule.Record] = true
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchers returns the label matchers of the allowlist matches
+func (l *MetricsAllowlist) matchers() [][]*labels.Matcher {
+	result := [][]*labels.Matcher{}
+	for _, match := range l.Matches {
+		// the matches are validated when the allowlist is parsed
+		matchers, _ := parser.ParseMetricSelector("{" + match + "}")
+		result = append(result, matchers)
+	}
+	return result
+}
+
+// MatchesName reports whether series of the metric name may be allowed by the matches
+func (l *MetricsAllowlist) MatchesName(name string) bool {
+	for _, matchers := range l.matchers() {
+		if matchLabel(matchers, model.MetricNameLabel, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesSeries reports whether the series is allowed by any of the matches
+func (l *MetricsAllowlist) MatchesSeries(metric model.Metric) bool {
+	for _, matchers := range l.matchers() {
+		matched := true
+		for _, m := range matchers {
+			if !m.Matches(string(metric[model.LabelName(m.Name)])) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLabel(matchers []*labels.Matcher, name, value string) bool {
+	for _, m := range matchers {
+		if m.Name == name && !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// getHubRecordNames returns the names of the series recorded by the thanos ruler
+func getHubRecordNames(opt TestOptions) ([]string, error) {
+	groups, err := GetThanosRuleGroups(opt)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, group := range groups {
+		for _, rule := range group.Rules {
+			if rule.Record.Value != "" {
+				names = append(names, rule.Record.Value)
+			}
+		}
+	}
+	return names, nil
+}
+
+// VerifyMetricsAllowlist compares the metric names stored on the hub for the cluster with the allowlist,
+// the ignored metrics are reported neither missing nor unexpected
+func VerifyMetricsAllowlist(client *PrometheusClient, cluster string, allowlist *MetricsAllowlist, ignores []string) (*AllowlistReport, error) {
+	found, err := countSeriesBy(client, model.MetricNameLabel, Metric("").Eq("cluster", cluster))
+	if err != nil {
+		return nil, err
+	}
+	foundSet := map[string]bool{}
+	for _, count := range found {
+		foundSet[count.Name] = true
+	}
+	expectedSet := map[string]bool{}
+	for _, name := range allowlist.ExpectedNames() {
+		expectedSet[name] = true
+	}
+	ignoreSet := map[string]bool{}
+	for _, name := range ignores {
+		expectedSet[name] = true
+		ignoreSet[name] = true
+	}
+
+	report := &AllowlistReport{Cluster: cluster, Missing: []string{}, Unexpected: []string{}}
+	for _, name := range allowlist.ExpectedNames() {
+		if !foundSet[name] && !ignoreSet[name] {
+			report.Missing = append(report.Missing, name)
+		}
+	}
+	for _, count := range found {
+		if expectedSet[count.Name] {
+			continue
+		}
+		if !allowlist.MatchesName(count.Name) {
+			report.Unexpected = append(report.Unexpected, count.Name)
+			continue
+		}
+		// the name is allowed by a match, so check the labels of each series
+		query, err := BuildQuery(Metric(count.Name).Eq("cluster", cluster))
+		if err != nil {
+			return nil, err
+		}
+		vector, err := client.QueryVector(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, sample := range vector {
+			if !allowlist.MatchesSeries(sample.Metric) {
+				report.Unexpected = append(report.Unexpected, sample.Metric.String())
+			}
+		}
+	}
+	sort.Strings(report.Unexpected)
+	return report, nil
+}
+
+// CheckMetricsAllowlist checks for every managed cluster that each allowlisted metric is on the hub,
+// renamed metrics are found under the new name, and no metric outside the allowlist is collected.
+// The ignores are added to the default ones, e.g. the allowlisted metrics a KinD cluster does not
+// expose, such as the OpenShift ones
+func CheckMetricsAllowlist(opt TestOptions, ignores ...string) error {
+	allowlist, err := GetMetricsAllowlist(opt)
+	if err != nil {
+		return err
+	}
+	recorded, err := getHubRecordNames(opt)
+	if err != nil {
+		return err
+	}
+	ignores = append(append(ignores, DefaultAllowlistIgnores...), recorded...)
+
+	clusters, err := ListObservabilityEnabledClusters(opt)
+	if err != nil {
+		return err
+	}
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err
+	}
+
+	problems := []string{}
+	for _, cluster := range clusters {
+		report, err := VerifyMetricsAllowlist(client, cluster, allowlist, ignores)
+		if err != nil {
+			return err
+		}
+		klog.V(1).Infof("allowlist verified for %s: %d missing, %d not allowlisted",
+			cluster, len(report.Missing), len(report.Unexpected))
+		if len(report.Missing) > 0 || len(report.Unexpected) > 0 {
+			problems = append(problems, report.String())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("metrics do not conform to the allowlist: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAllowlist = `
+names:
+  - :node_memory_MemAvailable_bytes:sum
+  - mixin_pod_workload
+  - up
+matches:
+  - __name__="workqueue_depth",job="apiserver"
+renames:
+  mixin_pod_workload: namespace_workload_pod:kube_pod_owner:relabel
+recording_rules:
+  - record: apiserver_request_duration_seconds:histogram_quantile_99
+    expr: histogram_quantile(0.99,sum(rate(apiserver_request_duration_seconds_bucket{job="apiserver"}[5m])) by (le))
+`
+
+func TestParseMetricsAllowlist(t *testing.T) {
+	allowlist, err := ParseMetricsAllowlist([]byte(testAllowlist))
+	require.NoError(t, err)
+	allowlist.Merge(&MetricsAllowlist{Names: []string{"node_memory_Active_bytes"}})
+
+	assert.Equal(t, []string{
+		":node_memory_MemAvailable_bytes:sum",
+		"apiserver_request_duration_seconds:histogram_quantile_99",
+		"namespace_workload_pod:kube_pod_owner:relabel",
+		"node_memory_Active_bytes",
+		"up",
+	}, allowlist.ExpectedNames())
+
+	assert.True(t, allowlist.MatchesName("workqueue_depth"))
+	assert.False(t, allowlist.MatchesName("workqueue_adds_total"))
+	assert.True(t, allowlist.MatchesSeries(model.Metric{"__name__": "workqueue_depth", "job": "apiserver"}))
+	assert.False(t, allowlist.MatchesSeries(model.Metric{"__name__": "workqueue_depth", "job": "kubelet"}))
+
+	_, err = ParseMetricsAllowlist([]byte(`matches: ['__name__="up",job=']`))
+	assert.Error(t, err, "invalid match")
+}
+
+func TestVerifyMetricsAllowlist(t *testing.T) {
+	server := newFakeQueryAPI(t, map[string]string{
+		`count by (__name__) ({cluster="cluster1"})`: `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"up"},"value":[1617000000,"10"]},
+			{"metric":{"__name__":"mixin_pod_workload"},"value":[1617000000,"3"]},
+			{"metric":{"__name__":"workqueue_depth"},"value":[1617000000,"2"]},
+			{"metric":{"__name__":"ALERTS"},"value":[1617000000,"1"]},
+			{"metric":{"__name__":"e2e_remote_write_probe"},"value":[1617000000,"1"]}]}}`,
+		`workqueue_depth{cluster="cluster1"}`: `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"workqueue_depth","cluster":"cluster1","job":"apiserver"},"value":[1617000000,"1"]},
+			{"metric":{"__name__":"workqueue_depth","cluster":"cluster1","job":"kubelet"},"value":[1617000000,"1"]}]}}`,
+	})
+	defer server.Close()
+	client := &PrometheusClient{URL: server.URL, Auth: BearerTokenAuth("test-token")}
+	allowlist, err := ParseMetricsAllowlist([]byte(testAllowlist))
+	require.NoError(t, err)
+
+	report, err := VerifyMetricsAllowlist(client, "cluster1", allowlist, DefaultAllowlistIgnores)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		":node_memory_MemAvailable_bytes:sum",
+		"apiserver_request_duration_seconds:histogram_quantile_99",
+		"namespace_workload_pod:kube_pod_owner:relabel",
+	}, report.Missing)
+	assert.Equal(t, []string{
+		"mixin_pod_workload",
+		`workqueue_depth{cluster="cluster1", job="kubelet"}`,
+	}, report.Unexpected)
+	report, err = VerifyMetricsAllowlist(client, "cluster1", allowlist,
+		append([]string{":node_memory_MemAvailable_bytes:sum"}, DefaultAllowlistIgnores...))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"apiserver_request_duration_seconds:histogram_quantile_99",
+		"namespace_workload_pod:kube_pod_owner:relabel",
+	}, report.Missing, "the ignored metrics are not missing")
+}
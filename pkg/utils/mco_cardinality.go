@@ -0,0 +1,171 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/common/model"
+	"k8s.io/klog"
+)
+
+// topOffenders is the number of over budget clusters and metrics reported
+const topOffenders = 10
+
+// CardinalityBudget is the maximum number of series the hub may store per managed cluster
+// and per metric name
+type CardinalityBudget struct {
+	MaxSeriesPerCluster int `json:"maxSeriesPerCluster"`
+	MaxSeriesPerMetric  int `json:"maxSeriesPerMetric"`
+	// Clusters and Metrics override the budget of single clusters and metrics
+	Clusters map[string]int `json:"clusters,omitempty"`
+	Metrics  map[string]int `json:"metrics,omitempty"`
+}
+
+// DefaultCardinalityBudget is used if no budget file is set in the options
+var DefaultCardinalityBudget = CardinalityBudget{
+	MaxSeriesPerCluster: 50000,
+	MaxSeriesPerMetric:  10000,
+}
+
+// SeriesCount is the number of series of a cluster or a metric name
+type SeriesCount struct {
+	Name   string
+	Series int
+	Budget int
+}
+
+// OverBudget reports whether there are more series than the budget allows
+func (c SeriesCount) OverBudget() bool {
+	return c.Budget > 0 && c.Series > c.Budget
+}
+
+func (c SeriesCount) String() string {
+	return fmt.Sprintf("%s: %d series (budget %d)", c.Name, c.Series, c.Budget)
+}
+
+// LoadCardinalityBudget reads the cardinality budget from a yaml file
+func LoadCardinalityBudget(path string) (*CardinalityBudget, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	budget := &CardinalityBudget{}
+	if err := yaml.Unmarshal(data, budget); err != nil {
+		return nil, fmt.Errorf("failed to parse cardinality budget %s: %v", path, err)
+	}
+	return budget, nil
+}
+
+// GetCardinalityBudget returns the budget from the file set in the options, or the default budget
+func GetCardinalityBudget(opt TestOptions) (*CardinalityBudget, error) {
+	if opt.CardinalityBudget != "" {
+		return LoadCardinalityBudget(opt.CardinalityBudget)
+	}
+	budget := DefaultCardinalityBudget
+	return &budget, nil
+}
+
+func (b *CardinalityBudget) clusterBudget(cluster string) int {
+	if n, ok := b.Clusters[cluster]; ok {
+		return n
+	}
+	return b.MaxSeriesPerCluster
+}
+
+func (b *CardinalityBudget) metricBudget(metric string) int {
+	if n, ok := b.Metrics[metric]; ok {
+		return n
+	}
+	return b.MaxSeriesPerMetric
+}
+
+// countSeriesBy returns the number of series grouped by the label, sorted by the number of series
+func countSeriesBy(client *PrometheusClient, label string, selector *Selector) ([]SeriesCount, error) {
+	query, err := BuildQuery(Aggregate("count", selector, label))
+	if err != nil {
+		return nil, err
+	}
+	vector, err := client.QueryVector(query)
+	if err != nil {
+		return nil, err
+	}
+	return seriesCounts(vector, model.LabelName(label)), nil
+}
+
+func seriesCounts(vector model.Vector, label model.LabelName) []SeriesCount {
+	counts := []SeriesCount{}
+	for _, sample := range vector {
+		counts = append(counts, SeriesCount{Name: string(sample.Metric[label]), Series: int(sample.Value)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Series != counts[j].Series {
+			return counts[i].Series > counts[j].Series
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// overBudget sets the budget of the counts and returns the ones over budget, at most topOffenders
+func overBudget(counts []SeriesCount, budget func(string) int) []SeriesCount {
+	offenders := []SeriesCount{}
+	for i := range counts {
+		counts[i].Budget = budget(counts[i].Name)
+		if counts[i].OverBudget() && len(offenders) < topOffenders {
+			offenders = append(offenders, counts[i])
+		}
+	}
+	return offenders
+}
+
+// CheckCardinalityBudget counts the series stored on the hub per managed cluster and per metric name,
+// and fails with the top offenders if any of them is over budget
+func CheckCardinalityBudget(opt TestOptions, budget *CardinalityBudget) error {
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err
+	}
+
+	allSeries := Metric("").Re("__name__", ".+")
+	// the series without cluster label, e.g. the ones of the hub components, are counted per metric only
+	clusters, err := countSeriesBy(client, "cluster", Metric("").Neq("cluster", ""))
+	if err != nil {
+		return err
+	}
+	metrics, err := countSeriesBy(client, "__name__", allSeries)
+	if err != nil {
+		return err
+	}
+	klog.V(1).Infof("series of %d clusters and %d metrics are stored on the hub", len(clusters), len(metrics))
+
+	problems := []string{}
+	for _, cluster := range overBudget(clusters, budget.clusterBudget) {
+		// list the metrics which contribute the most to the cluster over budget
+		top, err := countSeriesBy(client, "__name__", Metric("").Eq("cluster", cluster.Name))
+		if err != nil {
+			return err
+		}
+		if len(top) > topOffenders {
+			top = top[:topOffenders]
+		}
+		names := []string{}
+		for _, metric := range top {
+			names = append(names, fmt.Sprintf("%s=%d", metric.Name, metric.Series))
+		}
+		problems = append(problems, fmt.Sprintf("cluster %s, top metrics [%s]", cluster, strings.Join(names, ", ")))
+	}
+	for _, metric := range overBudget(metrics, budget.metricBudget) {
+		problems = append(problems, fmt.Sprintf("metric %s", metric))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("series over the cardinality budget: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverBudget(t *testing.T) {
+	vector := model.Vector{
+		{Metric: model.Metric{"cluster": "local-cluster"}, Value: 60000},
+		{Metric: model.Metric{"cluster": "cluster1"}, Value: 1200},
+		{Metric: model.Metric{"cluster": "cluster2"}, Value: 70000},
+	}
+	budget := &CardinalityBudget{
+		MaxSeriesPerCluster: 50000,
+		Clusters:            map[string]int{"local-cluster": 80000},
+	}
+
+	counts := seriesCounts(vector, "cluster")
+	assert.Equal(t, []string{"cluster2", "local-cluster", "cluster1"},
+		[]string{counts[0].Name, counts[1].Name, counts[2].Name}, "sorted by number of series")
+
+	offenders := overBudget(counts, budget.clusterBudget)
+	if assert.Len(t, offenders, 1) {
+		assert.Equal(t, SeriesCount{Name: "cluster2", Series: 70000, Budget: 50000}, offenders[0])
+	}
+	assert.Equal(t, 80000, counts[1].Budget, "budget overridden for local-cluster")
+}
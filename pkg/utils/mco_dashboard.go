@@ -4,66 +4,126 @@
 package utils
 
 import (
-	"crypto/tls"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-	"os"
-	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog"
 )
 
+// GrafanaGeneralFolder is the folder of the dashboards which are not in any folder
+const GrafanaGeneralFolder = "General"
+
+// ContainDashboard tells whether grafana has a dashboard with the exact title
 func ContainDashboard(opt TestOptions, title string) (error, bool) {
-	grafanaConsoleURL := GetGrafanaURL(opt)
-	path := "/api/search?"
-	queryParams := url.PathEscape(fmt.Sprintf("query=%s", title))
-	req, err := http.NewRequest(
-		"GET",
-		grafanaConsoleURL+path+queryParams,
-		nil)
+	client, stop, err := NewGrafanaClient(opt)
 	if err != nil {
 		return err, false
 	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	defer stop()
+	dashboard, err := client.FindDashboard(title)
+	if err != nil {
+		klog.Errorf("failed to search dashboard %s: %v\n", title, err)
+		return err, false
 	}
+	if dashboard == nil {
+		return fmt.Errorf("Failed to find the dashboard"), false
+	}
+	klog.V(1).Infof("found dashboard %s with uid %s in folder %q\n", title, dashboard.UID, dashboard.FolderTitle)
+	return nil, true
+}
 
-	client := &http.Client{Transport: tr}
-	if os.Getenv("IS_CANARY_ENV") == "true" {
-		token, err := FetchBearerToken(opt)
-		if err != nil {
-			return err, false
-		}
-		if token != "" {
-			req.Header.Set("Authorization", "Bearer "+token)
-		}
-	} else {
-		req.Header.Set("X-Forwarded-User", "WHAT_YOU_ARE_DOING_IS_VOIDING_SUPPORT_0000000000000000000000000000000000000000000000000000000000000000")
+// NewDashboardConfigMap returns the configmap of a dashboard with a single panel in the
+// observability namespace. The configmap is labeled for the dashboard loader unless unlabeled
+// is set, and annotated with the folder if it is not empty
+func NewDashboardConfigMap(name, uid, title, folder string, unlabeled bool) (*corev1.ConfigMap, error) {
+	dashboard := map[string]interface{}{
+		"uid":           uid,
+		"title":         title,
+		"schemaVersion": 27,
+		"panels": []interface{}{
+			map[string]interface{}{
+				"id":      1,
+				"type":    "graph",
+				"title":   "Up",
+				"gridPos": map[string]int{"h": 8, "w": 12, "x": 0, "y": 0},
+				"targets": []interface{}{map[string]string{"refId": "A", "expr": "up"}},
+			},
+		},
+	}
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return nil, err
 	}
-	req.Host = opt.HubCluster.GrafanaHost
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: MCO_NAMESPACE,
+		},
+		Data: map[string]string{name + ".json": string(data)},
+	}
+	if !unlabeled {
+		cm.Labels = map[string]string{GrafanaCustomDashboardLabel: "true"}
+	}
+	if folder != "" {
+		cm.Annotations = map[string]string{GrafanaDashboardFolderAnnotation: folder}
+	}
+	return cm, nil
+}
 
-	resp, err := client.Do(req)
+// CheckDashboardLoaded checks the dashboard with the uid has the title and is in the folder,
+// which defaults to the General one
+func CheckDashboardLoaded(client *GrafanaClient, uid, title, folder string) error {
+	dashboard, err := client.Dashboard(uid)
 	if err != nil {
-		return err, false
+		return err
+	}
+	if actual := dashboard.Dashboard["title"]; actual != title {
+		return fmt.Errorf("dashboard %s has title %v instead of %s", uid, actual, title)
+	}
+	if folder == "" {
+		folder = GrafanaGeneralFolder
+	}
+	actualFolder := dashboard.Meta.FolderTitle
+	if dashboard.Meta.FolderID == 0 {
+		actualFolder = GrafanaGeneralFolder
 	}
+	if actualFolder != folder {
+		return fmt.Errorf("dashboard %s is in folder %q instead of %q", uid, actualFolder, folder)
+	}
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		klog.Errorf("resp.StatusCode: %v\n", resp.StatusCode)
-		return fmt.Errorf("Failed to access grafana api"), false
+// CheckDashboardRemoved checks the dashboard with the uid is removed, and that the folder it was
+// in is not left empty
+func CheckDashboardRemoved(client *GrafanaClient, uid, folder string) error {
+	_, err := client.Dashboard(uid)
+	if err == nil {
+		return fmt.Errorf("dashboard %s is not removed", uid)
+	}
+	if !IsGrafanaNotFound(err) {
+		return err
+	}
+	if folder == "" || folder == GrafanaGeneralFolder {
+		return nil
 	}
 
-	result, err := ioutil.ReadAll(resp.Body)
-	klog.V(1).Infof("result: %s\n", result)
+	folders, err := client.Folders()
 	if err != nil {
-		return err, false
+		return err
 	}
-
-	if !strings.Contains(string(result), fmt.Sprintf(`"title":"%s"`, title)) {
-		return fmt.Errorf("Failed to find the dashboard"), false
-	} else {
-		return nil, true
+	for _, f := range folders {
+		if f.Title != folder {
+			continue
+		}
+		hits, err := client.Search(SearchQuery{FolderIDs: []int64{f.ID}})
+		if err != nil {
+			return err
+		}
+		if len(hits) == 0 {
+			return fmt.Errorf("folder %s is left empty after dashboard %s is removed", folder, uid)
+		}
 	}
+	return nil
 }
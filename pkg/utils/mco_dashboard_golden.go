@@ -0,0 +1,230 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// UpdateGoldenDashboardsEnv rewrites the golden dashboards instead of comparing them if set to true
+const UpdateGoldenDashboardsEnv = "UPDATE_GOLDEN_DASHBOARDS"
+
+// volatileDashboardFields are assigned by grafana when the dashboard is loaded or saved
+var volatileDashboardFields = []string{"id", "version", "iteration"}
+
+// NormalizeDashboard returns the dashboard JSON without the volatile fields, indented with sorted
+// keys so that it can be diffed
+func NormalizeDashboard(dashboard map[string]interface{}) ([]byte, error) {
+	normalized := map[string]interface{}{}
+	for key, value := range dashboard {
+		normalized[key] = value
+	}
+	for _, field := range volatileDashboardFields {
+		delete(normalized, field)
+	}
+	data, err := json.MarshalIndent(normalized, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// DiffDashboard returns the unified diff of the golden and the actual dashboard, or an empty string
+// if they are equal
+func DiffDashboard(name string, golden, actual []byte) (string, error) {
+	if string(golden) == string(actual) {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(golden)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: name + " (golden)",
+		ToFile:   name + " (grafana)",
+		Context:  3,
+	})
+}
+
+// DashboardGolden compares the dashboards with the golden files <uid>.json of the directory
+type DashboardGolden struct {
+	Dir string
+	// Update rewrites the golden files, and removes the ones of the dashboards which do not exist
+	Update bool
+}
+
+// NewDashboardGolden returns the golden files of the directory, which are updated if the
+// UPDATE_GOLDEN_DASHBOARDS env is set to true
+func NewDashboardGolden(dir string) DashboardGolden {
+	return DashboardGolden{Dir: dir, Update: os.Getenv(UpdateGoldenDashboardsEnv) == "true"}
+}
+
+// Files returns the uids of the dashboards which have a golden file
+func (g DashboardGolden) Files() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(g.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	uids := []string{}
+	for _, path := range paths {
+		uids = append(uids, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	sort.Strings(uids)
+	return uids, nil
+}
+
+// Compare diffs the normalized dashboards by uid with the golden files, and returns the diffs of
+// the changed, added and removed dashboards. In update mode the golden files are rewritten instead.
+// A directory without golden file is an error unless they are being created
+func (g DashboardGolden) Compare(dashboards map[string][]byte) ([]string, error) {
+	uids, err := g.Files()
+	if err != nil {
+		return nil, err
+	}
+	if len(uids) == 0 && !g.Update {
+		return nil, fmt.Errorf("no golden dashboard in %s, run with %s=true to create them", g.Dir, UpdateGoldenDashboardsEnv)
+	}
+	golden := map[string]bool{}
+	for _, uid := range uids {
+		golden[uid] = true
+	}
+
+	if g.Update {
+		if err := os.MkdirAll(g.Dir, 0755); err != nil {
+			return nil, err
+		}
+		for uid, data := range dashboards {
+			if err := ioutil.WriteFile(filepath.Join(g.Dir, uid+".json"), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+		for _, uid := range uids {
+			if _, ok := dashboards[uid]; !ok {
+				if err := os.Remove(filepath.Join(g.Dir, uid+".json")); err != nil {
+					return nil, err
+				}
+			}
+		}
+		klog.V(1).Infof("updated %d golden dashboards in %s", len(dashboards), g.Dir)
+		return nil, nil
+	}
+
+	all := append([]string{}, uids...)
+	for uid := range dashboards {
+		if !golden[uid] {
+			all = append(all, uid)
+		}
+	}
+	sort.Strings(all)
+
+	diffs := []string{}
+	for _, uid := range all {
+		var expected []byte
+		if golden[uid] {
+			expected, err = ioutil.ReadFile(filepath.Join(g.Dir, uid+".json"))
+			if err != nil {
+				return nil, err
+			}
+		}
+		diff, err := DiffDashboard(uid+".json", expected, dashboards[uid])
+		if err != nil {
+			return nil, err
+		}
+		if diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+// ManagedDashboardUIDs returns the uids of the dashboards of the configmaps the operator manages
+// in the observability namespace
+func ManagedDashboardUIDs(opt TestOptions) ([]string, error) {
+	clientKube := getKubeClient(opt, true)
+	cms, err := clientKube.CoreV1().ConfigMaps(MCO_NAMESPACE).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	uids := []string{}
+	for _, cm := range cms.Items {
+		managed := false
+		for _, owner := range cm.OwnerReferences {
+			managed = managed || owner.Kind == "MultiClusterObservability"
+		}
+		if !managed {
+			continue
+		}
+		for key, data := range cm.Data {
+			if !strings.HasSuffix(key, ".json") {
+				continue
+			}
+			dashboard := struct {
+				UID string `json:"uid"`
+			}{}
+			if err := json.Unmarshal([]byte(data), &dashboard); err != nil || dashboard.UID == "" {
+				klog.V(3).Infof("%s of configmap %s is not a dashboard", key, cm.Name)
+				continue
+			}
+			uids = append(uids, dashboard.UID)
+		}
+	}
+	sort.Strings(uids)
+	return uids, nil
+}
+
+// ExportManagedDashboards exports the dashboards managed by the operator through the grafana API
+// and returns them normalized by uid
+func ExportManagedDashboards(opt TestOptions, client *GrafanaClient) (map[string][]byte, error) {
+	uids, err := ManagedDashboardUIDs(opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(uids) == 0 {
+		return nil, fmt.Errorf("no dashboard managed by the operator found in namespace %s", MCO_NAMESPACE)
+	}
+	dashboards := map[string][]byte{}
+	for _, uid := range uids {
+		dashboard, err := client.Dashboard(uid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export dashboard %s: %v", uid, err)
+		}
+		data, err := NormalizeDashboard(dashboard.Dashboard)
+		if err != nil {
+			return nil, err
+		}
+		dashboards[uid] = data
+	}
+	return dashboards, nil
+}
+
+// CheckDashboardGoldenFiles exports the dashboards managed by the operator and diffs them with the
+// golden files of the directory
+func CheckDashboardGoldenFiles(opt TestOptions, dir string) error {
+	client, stop, err := NewGrafanaClient(opt)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	dashboards, err := ExportManagedDashboards(opt, client)
+	if err != nil {
+		return err
+	}
+	diffs, err := NewDashboardGolden(dir).Compare(dashboards)
+	if err != nil {
+		return err
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d dashboards differ from the golden files in %s, set %s=true to update them:\n%s",
+			len(diffs), dir, UpdateGoldenDashboardsEnv, strings.Join(diffs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeDashboard(t *testing.T) {
+	dashboard := map[string]interface{}{"id": 12, "uid": "abc", "version": 3, "iteration": 1617000000, "title": "Overview",
+		"panels": []interface{}{map[string]interface{}{"id": 1, "title": "CPU"}}}
+	data, err := NormalizeDashboard(dashboard)
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "panels": [
+    {
+      "id": 1,
+      "title": "CPU"
+    }
+  ],
+  "title": "Overview",
+  "uid": "abc"
+}
+`, string(data), "the panel ids are kept")
+	assert.Contains(t, dashboard, "id", "the dashboard is not modified")
+}
+
+func TestDashboardGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	golden := DashboardGolden{Dir: filepath.Join(dir, "dashboards")}
+
+	overview, _ := NormalizeDashboard(map[string]interface{}{"uid": "overview", "title": "Overview"})
+	nodes, _ := NormalizeDashboard(map[string]interface{}{"uid": "nodes", "title": "Nodes"})
+	_, err = golden.Compare(map[string][]byte{"overview": overview, "nodes": nodes})
+	assert.EqualError(t, err, "no golden dashboard in "+golden.Dir+", run with UPDATE_GOLDEN_DASHBOARDS=true to create them")
+
+	golden.Update = true
+	diffs, err := golden.Compare(map[string][]byte{"overview": overview, "nodes": nodes})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+	uids, err := golden.Files()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nodes", "overview"}, uids)
+
+	golden.Update = false
+	diffs, err = golden.Compare(map[string][]byte{"overview": overview, "nodes": nodes})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	changed, _ := NormalizeDashboard(map[string]interface{}{"uid": "overview", "title": "Clusters Overview"})
+	pods, _ := NormalizeDashboard(map[string]interface{}{"uid": "pods", "title": "Pods"})
+	diffs, err = golden.Compare(map[string][]byte{"overview": changed, "pods": pods})
+	require.NoError(t, err)
+	require.Len(t, diffs, 3, "the removed, changed and added dashboards are reported")
+	assert.Contains(t, diffs[0], `-  "title": "Nodes",`)
+	assert.Contains(t, diffs[1], "--- overview.json (golden)\n+++ overview.json (grafana)\n")
+	assert.Contains(t, diffs[1], `-  "title": "Overview",`+"\n"+`+  "title": "Clusters Overview",`)
+	assert.Contains(t, diffs[2], `+  "title": "Pods",`)
+
+	golden.Update = true
+	_, err = golden.Compare(map[string][]byte{"overview": changed})
+	require.NoError(t, err)
+	uids, err = golden.Files()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"overview"}, uids, "the golden files of the removed dashboards are deleted")
+	data, err := ioutil.ReadFile(filepath.Join(golden.Dir, "overview.json"))
+	require.NoError(t, err)
+	assert.Equal(t, string(changed), string(data))
+}
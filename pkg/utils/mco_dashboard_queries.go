@@ -0,0 +1,414 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"k8s.io/klog"
+)
+
+const (
+	// DefaultPanelQueryWindow is how far back the panel queries are evaluated
+	DefaultPanelQueryWindow = 30 * time.Minute
+	// DefaultPanelQueryStep is the resolution of the panel queries
+	DefaultPanelQueryStep = time.Minute
+	// variableAll is the value of a template variable with the All option selected
+	variableAll = "$__all"
+)
+
+var (
+	// variableRef matches $var, ${var}, ${var:format} and [[var]]
+	variableRef = regexp.MustCompile(`\$\{(\w+)(?::\w+)?\}|\[\[(\w+)(?::\w+)?\]\]|\$(\w+)`)
+	// labelValuesQuery matches label_values(label) and label_values(selector, label)
+	labelValuesQuery = regexp.MustCompile(`^\s*label_values\(\s*(?:(.+?)\s*,\s*)?(\w+)\s*\)\s*$`)
+)
+
+// PanelTarget is a PromQL target of a dashboard panel
+type PanelTarget struct {
+	Dashboard string
+	Panel     string
+	RefID     string
+	// Expr is the expression of the target, Query is the expression with the template
+	// variables substituted
+	Expr  string
+	Query string
+}
+
+func (t PanelTarget) String() string {
+	if t.RefID == "" {
+		return fmt.Sprintf("panel %q", t.Panel)
+	}
+	return fmt.Sprintf("panel %q target %s", t.Panel, t.RefID)
+}
+
+// PanelProblem is a panel target which fails or returns no data
+type PanelProblem struct {
+	Target PanelTarget
+	// Err is nil if the query succeeds without data
+	Err error
+}
+
+func (p PanelProblem) String() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s failed: %v: %s", p.Target, p.Err, p.Target.Query)
+	}
+	return fmt.Sprintf("%s has no data: %s", p.Target, p.Target.Query)
+}
+
+// DashboardQueryReport is the result of the panel queries of the dashboards
+type DashboardQueryReport struct {
+	Queries int
+	// Problems are grouped by dashboard title
+	Problems map[string][]PanelProblem
+}
+
+// Failed returns the problems of the queries which fail, grouped by dashboard
+func (r DashboardQueryReport) Failed() map[string][]PanelProblem {
+	return r.filter(func(p PanelProblem) bool { return p.Err != nil })
+}
+
+// NoData returns the problems of the queries which succeed without data, grouped by dashboard
+func (r DashboardQueryReport) NoData() map[string][]PanelProblem {
+	return r.filter(func(p PanelProblem) bool { return p.Err == nil })
+}
+
+// NoDataExcept returns the problems of the queries which succeed without data, except the ones of
+// the panels allowed to be empty, which are listed by dashboard title
+func (r DashboardQueryReport) NoDataExcept(allowed map[string][]string) map[string][]PanelProblem {
+	return r.filter(func(p PanelProblem) bool {
+		if p.Err != nil {
+			return false
+		}
+		for _, panel := range allowed[p.Target.Dashboard] {
+			if panel == p.Target.Panel {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (r DashboardQueryReport) filter(keep func(PanelProblem) bool) map[string][]PanelProblem {
+	filtered := map[string][]PanelProblem{}
+	for dashboard, problems := range r.Problems {
+		for _, problem := range problems {
+			if keep(problem) {
+				filtered[dashboard] = append(filtered[dashboard], problem)
+			}
+		}
+	}
+	return filtered
+}
+
+func (r DashboardQueryReport) String() string {
+	dashboards := []string{}
+	count := 0
+	for dashboard, problems := range r.Problems {
+		dashboards = append(dashboards, dashboard)
+		count += len(problems)
+	}
+	sort.Strings(dashboards)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d panel queries failed or returned no data", count, r.Queries)
+	for _, dashboard := range dashboards {
+		fmt.Fprintf(&b, "\n%s:", dashboard)
+		for _, problem := range r.Problems[dashboard] {
+			fmt.Fprintf(&b, "\n  %s", problem)
+		}
+	}
+	return b.String()
+}
+
+// ExtractPanelTargets returns the PromQL targets of the panels of the dashboard, including the
+// panels nested in rows. Hidden targets and the targets of other datasources are skipped
+func ExtractPanelTargets(dashboard map[string]interface{}) []PanelTarget {
+	title, _ := dashboard["title"].(string)
+	panels := asList(dashboard["panels"])
+	// the dashboards of the old schema have their panels in rows
+	for _, row := range asList(dashboard["rows"]) {
+		panels = append(panels, asList(asMap(row)["panels"])...)
+	}
+
+	targets := []PanelTarget{}
+	for len(panels) > 0 {
+		panel := asMap(panels[0])
+		panels = panels[1:]
+		panels = append(panels, asList(panel["panels"])...)
+
+		panelTitle, _ := panel["title"].(string)
+		if panelTitle == "" {
+			panelTitle = fmt.Sprintf("%v", panel["id"])
+		}
+		for _, t := range asList(panel["targets"]) {
+			target := asMap(t)
+			expr, _ := target["expr"].(string)
+			if hide, _ := target["hide"].(bool); hide || strings.TrimSpace(expr) == "" {
+				continue
+			}
+			datasource := target["datasource"]
+			if datasource == nil {
+				datasource = panel["datasource"]
+			}
+			if !isPrometheusDatasource(datasource) {
+				continue
+			}
+			refID, _ := target["refId"].(string)
+			targets = append(targets, PanelTarget{Dashboard: title, Panel: panelTitle, RefID: refID, Expr: expr})
+		}
+	}
+	return targets
+}
+
+// isPrometheusDatasource tells whether the panel datasource may be a prometheus one, the
+// datasources referenced by name or variable are assumed to be
+func isPrometheusDatasource(datasource interface{}) bool {
+	switch ds := datasource.(type) {
+	case string:
+		return !strings.HasPrefix(ds, "-- ")
+	case map[string]interface{}:
+		dsType, _ := ds["type"].(string)
+		return dsType == "" || dsType == "prometheus"
+	}
+	return true
+}
+
+// TemplateVariable is a variable of the templating of a dashboard
+type TemplateVariable struct {
+	Name string
+	Type string
+	// Query is the query of the query variables, or the options of the custom variables
+	Query string
+	// Current is the value selected when the dashboard was saved
+	Current []string
+}
+
+// DashboardVariables returns the template variables of the dashboard in the order they are defined,
+// which is the order they depend on each other
+func DashboardVariables(dashboard map[string]interface{}) []TemplateVariable {
+	variables := []TemplateVariable{}
+	for _, v := range asList(asMap(dashboard["templating"])["list"]) {
+		variable := asMap(v)
+		tv := TemplateVariable{}
+		tv.Name, _ = variable["name"].(string)
+		tv.Type, _ = variable["type"].(string)
+		switch query := variable["query"].(type) {
+		case string:
+			tv.Query = query
+		case map[string]interface{}:
+			tv.Query, _ = query["query"].(string)
+		}
+		switch current := asMap(variable["current"])["value"].(type) {
+		case string:
+			tv.Current = []string{current}
+		case []interface{}:
+			for _, value := range current {
+				if s, ok := value.(string); ok {
+					tv.Current = append(tv.Current, s)
+				}
+			}
+		}
+		if tv.Name != "" {
+			variables = append(variables, tv)
+		}
+	}
+	return variables
+}
+
+// builtinVariables are the values of the grafana global variables used in the panel queries
+func builtinVariables(window, step time.Duration) map[string]string {
+	interval := model.Duration(step).String()
+	return map[string]string{
+		"__interval":      interval,
+		"__rate_interval": model.Duration(4 * step).String(),
+		"__range":         model.Duration(window).String(),
+		"interval":        interval,
+		"resolution":      "1",
+	}
+}
+
+// SubstituteVariables replaces the references to the variables in the expression with their
+// values. The unknown variables are left as they are
+func SubstituteVariables(expr string, values map[string]string) string {
+	return variableRef.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := variableRef.FindStringSubmatch(ref)
+		name := m[1] + m[2] + m[3]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// variableValue returns the value a multi-value variable is substituted with, the values are
+// joined as a regex since the variables are matched with =~ in the dashboards
+func variableValue(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = regexp.QuoteMeta(value)
+	}
+	return "(" + strings.Join(escaped, "|") + ")"
+}
+
+// ResolveVariables returns the values of the template variables of the dashboard. The overrides,
+// e.g. the name of a managed cluster, take precedence, the label_values queries are resolved with
+// the first value returned by the client, and the other variables keep their current value
+func ResolveVariables(client *PrometheusClient, dashboard map[string]interface{}, overrides map[string]string, window, step time.Duration) map[string]string {
+	values := builtinVariables(window, step)
+	for _, variable := range DashboardVariables(dashboard) {
+		if value, ok := overrides[variable.Name]; ok {
+			values[variable.Name] = value
+			continue
+		}
+		if variable.Type == "query" && client != nil {
+			if value, err := resolveLabelValues(client, SubstituteVariables(variable.Query, values)); err != nil {
+				klog.V(1).Infof("failed to resolve variable %s of dashboard %v: %v", variable.Name, dashboard["title"], err)
+			} else if value != "" {
+				values[variable.Name] = value
+				continue
+			}
+		}
+		switch {
+		case len(variable.Current) == 0:
+		case len(variable.Current) == 1 && variable.Current[0] == variableAll:
+			values[variable.Name] = ".*"
+		default:
+			values[variable.Name] = variableValue(variable.Current)
+		}
+	}
+	return values
+}
+
+// resolveLabelValues returns the first value of the label_values query, or an empty string if the
+// query is not a label_values one
+func resolveLabelValues(client *PrometheusClient, query string) (string, error) {
+	m := labelValuesQuery.FindStringSubmatch(query)
+	if m == nil {
+		return "", nil
+	}
+	selector, label := m[1], m[2]
+	if selector == "" {
+		selector = fmt.Sprintf(`{%s!=""}`, label)
+	}
+	vector, err := client.QueryVector(fmt.Sprintf("count by (%s) (%s)", label, selector))
+	if err != nil {
+		return "", err
+	}
+	values := []string{}
+	for _, sample := range vector {
+		if value := string(sample.Metric[model.LabelName(label)]); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("no value of %s in %s", label, selector)
+	}
+	sort.Strings(values)
+	return values[0], nil
+}
+
+// PanelQueryTester runs the panel queries of the grafana dashboards
+type PanelQueryTester struct {
+	Grafana *GrafanaClient
+	Query   *PrometheusClient
+	// Overrides are the values of the template variables, e.g. cluster
+	Overrides map[string]string
+	// Window and Step default to DefaultPanelQueryWindow and DefaultPanelQueryStep
+	Window time.Duration
+	Step   time.Duration
+}
+
+// NewPanelQueryTester returns the tester of the dashboards of the hub grafana, which runs the
+// queries through the query endpoint of the options with the cluster variable set to the first
+// managed cluster. The returned stop function closes the grafana client
+func NewPanelQueryTester(opt TestOptions) (*PanelQueryTester, func(), error) {
+	grafana, stop, err := NewGrafanaClient(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	query, err := NewPrometheusClient(opt)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	cluster := GetManagedClusterName(opt)
+	if cluster == "" {
+		cluster = "local-cluster"
+	}
+	return &PanelQueryTester{
+		Grafana:   grafana,
+		Query:     query,
+		Overrides: map[string]string{"cluster": cluster},
+	}, stop, nil
+}
+
+// TestDashboard runs the queries of the panels of the dashboard and returns the targets which
+// fail or return no data, and the number of queries
+func (t *PanelQueryTester) TestDashboard(dashboard map[string]interface{}) ([]PanelProblem, int) {
+	window, step := t.Window, t.Step
+	if window == 0 {
+		window = DefaultPanelQueryWindow
+	}
+	if step == 0 {
+		step = DefaultPanelQueryStep
+	}
+	values := ResolveVariables(t.Query, dashboard, t.Overrides, window, step)
+
+	problems := []PanelProblem{}
+	targets := ExtractPanelTargets(dashboard)
+	end := time.Now()
+	for _, target := range targets {
+		target.Query = SubstituteVariables(target.Expr, values)
+		matrix, err := t.Query.QueryRange(target.Query, end.Add(-window), end, step)
+		if err != nil {
+			problems = append(problems, PanelProblem{Target: target, Err: err})
+			continue
+		}
+		if len(matrix) == 0 {
+			problems = append(problems, PanelProblem{Target: target})
+		}
+	}
+	return problems, len(targets)
+}
+
+// TestDashboards runs the panel queries of every dashboard of grafana
+func (t *PanelQueryTester) TestDashboards() (*DashboardQueryReport, error) {
+	hits, err := t.Grafana.Search(SearchQuery{Type: "dash-db"})
+	if err != nil {
+		return nil, err
+	}
+	report := &DashboardQueryReport{Problems: map[string][]PanelProblem{}}
+	for _, hit := range hits {
+		dashboard, err := t.Grafana.Dashboard(hit.UID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dashboard %s: %v", hit.Title, err)
+		}
+		problems, queries := t.TestDashboard(dashboard.Dashboard)
+		klog.V(1).Infof("dashboard %s: %d of %d panel queries failed or returned no data", hit.Title, len(problems), queries)
+		report.Queries += queries
+		if len(problems) > 0 {
+			report.Problems[hit.Title] = problems
+		}
+	}
+	return report, nil
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
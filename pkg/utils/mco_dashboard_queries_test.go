@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDashboard = `{
+  "title": "Cluster Overview",
+  "templating": {"list": [
+    {"name": "datasource", "type": "datasource", "query": "prometheus"},
+    {"name": "cluster", "type": "query", "query": "label_values(up, cluster)", "current": {"value": "stale-cluster"}},
+    {"name": "namespace", "type": "query", "query": {"query": "label_values(kube_pod_info{cluster=\"$cluster\"}, namespace)"}, "current": {"value": "$__all"}},
+    {"name": "node", "type": "custom", "query": "a,b", "current": {"value": ["a", "b.1"]}}
+  ]},
+  "panels": [
+    {"id": 1, "title": "CPU", "datasource": "$datasource", "targets": [
+      {"refId": "A", "expr": "sum(rate(node_cpu_seconds_total{cluster=\"$cluster\"}[$__rate_interval]))"},
+      {"refId": "B", "expr": "up", "hide": true}
+    ]},
+    {"id": 2, "type": "row", "title": "Pods", "panels": [
+      {"id": 3, "title": "Pods by namespace", "targets": [{"refId": "A", "expr": "count(kube_pod_info{cluster=\"${cluster}\",namespace=~\"[[namespace]]\",node=~\"$node\"})"}]}
+    ]},
+    {"id": 4, "title": "Annotations", "datasource": "-- Grafana --", "targets": [{"refId": "A", "expr": "up"}]},
+    {"id": 5, "title": "Broken", "datasource": {"type": "prometheus", "uid": "p1"}, "targets": [{"refId": "A", "expr": "sum(rate(missing[5m])"}]}
+  ]
+}`
+
+// newFakeQueryEndpoint answers the count by (cluster) and count by (namespace) queries of the variables,
+// the CPU panel query, and fails the queries which are not valid
+func newFakeQueryEndpoint(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		switch {
+		case query == "count by (cluster) (up)":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"cluster":"managed-2"},"value":[1617000000,"1"]},{"metric":{"cluster":"managed-1"},"value":[1617000000,"1"]}]}}`)
+		case query == `count by (namespace) (kube_pod_info{cluster="managed-1"})`:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case strings.HasPrefix(query, "sum(rate(node_cpu_seconds_total"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1617000000,"0.5"]]}]}}`)
+		case strings.Count(query, "(") != strings.Count(query, ")"):
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error: unclosed left parenthesis"}`)
+		default:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[]}}`)
+		}
+	}))
+}
+
+func TestExtractPanelTargets(t *testing.T) {
+	dashboard := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(testDashboard), &dashboard))
+
+	targets := ExtractPanelTargets(dashboard)
+	require.Len(t, targets, 3, "the hidden target and the grafana annotations are skipped")
+	assert.Equal(t, "CPU", targets[0].Panel)
+	assert.Equal(t, "Broken", targets[1].Panel)
+	assert.Equal(t, "Pods by namespace", targets[2].Panel, "the panels of the rows are extracted")
+	assert.Equal(t, "Cluster Overview", targets[2].Dashboard)
+
+	variables := DashboardVariables(dashboard)
+	require.Len(t, variables, 4)
+	assert.Equal(t, `label_values(kube_pod_info{cluster="$cluster"}, namespace)`, variables[2].Query)
+	assert.Equal(t, []string{"a", "b.1"}, variables[3].Current)
+}
+
+func TestSubstituteVariables(t *testing.T) {
+	values := map[string]string{"cluster": "managed-1", "__rate_interval": "4m"}
+	assert.Equal(t, `rate(up{cluster="managed-1",a="managed-1",b="managed-1"}[4m]) + $unknown`,
+		SubstituteVariables(`rate(up{cluster="$cluster",a="${cluster:regex}",b="[[cluster]]"}[$__rate_interval]) + $unknown`, values))
+}
+
+func TestPanelQueryTester(t *testing.T) {
+	server := newFakeQueryEndpoint(t)
+	defer server.Close()
+	dashboard := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(testDashboard), &dashboard))
+	tester := &PanelQueryTester{Query: &PrometheusClient{URL: server.URL}}
+
+	values := ResolveVariables(tester.Query, dashboard, nil, DefaultPanelQueryWindow, DefaultPanelQueryStep)
+	assert.Equal(t, "managed-1", values["cluster"], "the first value of label_values is used")
+	assert.Equal(t, ".*", values["namespace"], "the current value is used if label_values has no value")
+	assert.Equal(t, `(a|b\.1)`, values["node"])
+	assert.Equal(t, "30m", values["__range"])
+	assert.Equal(t, "managed-2", ResolveVariables(tester.Query, dashboard, map[string]string{"cluster": "managed-2"}, DefaultPanelQueryWindow, DefaultPanelQueryStep)["cluster"])
+
+	problems, queries := tester.TestDashboard(dashboard)
+	assert.Equal(t, 3, queries)
+	require.Len(t, problems, 2)
+	assert.Error(t, problems[0].Err)
+	assert.Equal(t, "Broken", problems[0].Target.Panel)
+	assert.NoError(t, problems[1].Err)
+	assert.Equal(t, `count(kube_pod_info{cluster="managed-1",namespace=~".*",node=~"(a|b\.1)"})`, problems[1].Target.Query)
+
+	report := DashboardQueryReport{Queries: queries, Problems: map[string][]PanelProblem{"Cluster Overview": problems}}
+	assert.Len(t, report.Failed()["Cluster Overview"], 1)
+	assert.Len(t, report.NoData()["Cluster Overview"], 1)
+	assert.Empty(t, report.NoDataExcept(map[string][]string{"Cluster Overview": {"Pods by namespace"}}))
+	assert.Len(t, report.NoDataExcept(map[string][]string{"Cluster Overview": {"CPU"}, "Pods by namespace": {"Pods by namespace"}})["Cluster Overview"], 1)
+	assert.True(t, strings.HasPrefix(report.String(), "2 of 3 panel queries failed or returned no data\nCluster Overview:\n  panel \"Broken\" target A failed"))
+}
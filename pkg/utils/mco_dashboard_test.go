@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDashboardConfigMap(t *testing.T) {
+	cm, err := NewDashboardConfigMap("e2e-folder-dashboard", "e2e-folder", "Folder Dashboard for E2E", "E2E", false)
+	require.NoError(t, err)
+	assert.Equal(t, MCO_NAMESPACE, cm.Namespace)
+	assert.Equal(t, "true", cm.Labels[GrafanaCustomDashboardLabel])
+	assert.Equal(t, "E2E", cm.Annotations[GrafanaDashboardFolderAnnotation])
+	dashboard := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(cm.Data["e2e-folder-dashboard.json"]), &dashboard))
+	assert.Equal(t, "e2e-folder", dashboard["uid"])
+	assert.Len(t, ExtractPanelTargets(dashboard), 1)
+
+	cm, err = NewDashboardConfigMap("e2e-unlabeled-dashboard", "e2e-unlabeled", "Unlabeled Dashboard for E2E", "", true)
+	require.NoError(t, err)
+	assert.Empty(t, cm.Labels)
+	assert.Empty(t, cm.Annotations)
+}
+
+func TestCheckDashboardFolder(t *testing.T) {
+	folderDashboards := map[string]string{"2": `[]`, "3": `[{"uid":"other","title":"Other"}]`}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/dashboards/uid/in-folder":
+			fmt.Fprint(w, `{"dashboard":{"uid":"in-folder","title":"E2E"},"meta":{"folderId":2,"folderTitle":"E2E"}}`)
+		case "/api/dashboards/uid/in-general":
+			fmt.Fprint(w, `{"dashboard":{"uid":"in-general","title":"E2E"},"meta":{"folderId":0,"folderTitle":"General"}}`)
+		case "/api/folders":
+			fmt.Fprint(w, `[{"id":2,"uid":"f2","title":"E2E"},{"id":3,"uid":"f3","title":"Shared"}]`)
+		case "/api/search":
+			fmt.Fprint(w, folderDashboards[r.URL.Query().Get("folderIds")])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Dashboard not found"}`)
+		}
+	}))
+	defer server.Close()
+	client := &GrafanaClient{URL: server.URL}
+
+	assert.NoError(t, CheckDashboardLoaded(client, "in-folder", "E2E", "E2E"))
+	assert.EqualError(t, CheckDashboardLoaded(client, "in-folder", "E2E", ""), `dashboard in-folder is in folder "E2E" instead of "General"`)
+	assert.EqualError(t, CheckDashboardLoaded(client, "in-folder", "Updated E2E", "E2E"), "dashboard in-folder has title E2E instead of Updated E2E")
+	assert.NoError(t, CheckDashboardLoaded(client, "in-general", "E2E", ""))
+	assert.Error(t, CheckDashboardLoaded(client, "missing", "E2E", ""))
+
+	assert.EqualError(t, CheckDashboardRemoved(client, "in-folder", "E2E"), "dashboard in-folder is not removed")
+	assert.EqualError(t, CheckDashboardRemoved(client, "removed", "E2E"), "folder E2E is left empty after dashboard removed is removed")
+	assert.NoError(t, CheckDashboardRemoved(client, "removed", "Shared"), "the folder has other dashboards")
+	assert.NoError(t, CheckDashboardRemoved(client, "removed", "Deleted"))
+	assert.NoError(t, CheckDashboardRemoved(client, "removed", ""))
+}
@@ -3,12 +3,620 @@
 
 package utils
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	GrafanaAuthBearer        = "bearer"
+	GrafanaAuthForwardedUser = "forwarded-user"
+	GrafanaAuthBasic         = "basic"
+	GrafanaAuthNone          = "none"
+	// GrafanaLabel is the app label of the grafana pods
+	GrafanaLabel = "multicluster-observability-grafana"
+	// GrafanaForwardedUserHeader is the header the grafana auth proxy authenticates the users with
+	GrafanaForwardedUserHeader = "X-Forwarded-User"
+	// GrafanaAdminUser is the grafana admin which can be impersonated when the oauth proxy is bypassed
+	GrafanaAdminUser = "WHAT_YOU_ARE_DOING_IS_VOIDING_SUPPORT_0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// GetGrafanaURL returns the grafana URL of the options, which defaults to the grafana of the
+// multicloud console. The Host header is only overridden if grafanaHost is set
 func GetGrafanaURL(opt TestOptions) string {
-	grafanaConsoleURL := "https://multicloud-console.apps." + opt.HubCluster.BaseDomain + "/grafana/"
 	if opt.HubCluster.GrafanaURL != "" {
-		grafanaConsoleURL = opt.HubCluster.GrafanaURL
-	} else {
-		opt.HubCluster.GrafanaHost = "multicloud-console.apps." + opt.HubCluster.BaseDomain
+		return opt.HubCluster.GrafanaURL
+	}
+	return "https://multicloud-console.apps." + opt.HubCluster.BaseDomain + "/grafana/"
+}
+
+// ResolveGrafanaAuth returns the grafana authentication of the options with the defaults filled
+// in: the oauth proxy is passed with a bearer token in the canary environment, otherwise it is
+// bypassed by impersonating the grafana admin
+func ResolveGrafanaAuth(opt TestOptions) GrafanaAuth {
+	auth := opt.GrafanaAuth
+	if auth.Mode == "" {
+		auth.Mode = GrafanaAuthForwardedUser
+		if os.Getenv("IS_CANARY_ENV") == "true" {
+			auth.Mode = GrafanaAuthBearer
+		}
+	}
+	if auth.Mode == GrafanaAuthForwardedUser && auth.User == "" {
+		auth.User = GrafanaAdminUser
+	}
+	return auth
+}
+
+// NewGrafanaAuth returns the credentials of the requests sent to grafana, the bearer token
+// defaults to the token of the testing service account
+func NewGrafanaAuth(opt TestOptions) (HTTPAuth, error) {
+	auth := ResolveGrafanaAuth(opt)
+	switch auth.Mode {
+	case GrafanaAuthBearer:
+		token := auth.BearerToken
+		if token == "" {
+			var err error
+			token, err = FetchBearerToken(opt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return BearerTokenAuth(token), nil
+	case GrafanaAuthForwardedUser:
+		return HeaderAuth{Name: GrafanaForwardedUserHeader, Value: auth.User}, nil
+	case GrafanaAuthBasic:
+		if auth.Username == "" {
+			return nil, fmt.Errorf("grafana %s auth requires a username", auth.Mode)
+		}
+		return BasicAuth{Username: auth.Username, Password: auth.Password}, nil
+	case GrafanaAuthNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown grafana auth mode %s, expected one of %s, %s, %s or %s",
+		auth.Mode, GrafanaAuthBearer, GrafanaAuthForwardedUser, GrafanaAuthBasic, GrafanaAuthNone)
+}
+
+// GrafanaClient calls the Grafana HTTP API
+type GrafanaClient struct {
+	URL string
+	// Host overrides the Host header of the requests if set
+	Host       string
+	Auth       HTTPAuth
+	HTTPClient *http.Client
+}
+
+// GrafanaError is the error reported by the Grafana HTTP API
+type GrafanaError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *GrafanaError) Error() string {
+	return fmt.Sprintf("%s %s failed with status code %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// IsGrafanaNotFound tells whether the error is a grafana 404
+func IsGrafanaNotFound(err error) bool {
+	grafanaErr, ok := err.(*GrafanaError)
+	return ok && grafanaErr.StatusCode == http.StatusNotFound
+}
+
+// SearchQuery filters the dashboards and folders returned by /api/search
+type SearchQuery struct {
+	Query string
+	// Type is dash-db or dash-folder
+	Type      string
+	FolderIDs []int64
+	Tags      []string
+}
+
+// SearchHit is a dashboard or a folder found by /api/search
+type SearchHit struct {
+	ID          int64    `json:"id"`
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Type        string   `json:"type"`
+	Tags        []string `json:"tags"`
+	FolderID    int64    `json:"folderId"`
+	FolderUID   string   `json:"folderUid"`
+	FolderTitle string   `json:"folderTitle"`
+}
+
+// DashboardMeta is the metadata of a dashboard returned by /api/dashboards/uid/:uid
+type DashboardMeta struct {
+	Slug        string `json:"slug"`
+	URL         string `json:"url"`
+	Version     int64  `json:"version"`
+	FolderID    int64  `json:"folderId"`
+	FolderUID   string `json:"folderUid"`
+	FolderTitle string `json:"folderTitle"`
+	Provisioned bool   `json:"provisioned"`
+}
+
+// DashboardWithMeta is a dashboard, kept as decoded JSON so it can be exported as is
+type DashboardWithMeta struct {
+	Dashboard map[string]interface{} `json:"dashboard"`
+	Meta      DashboardMeta          `json:"meta"`
+}
+
+// Folder is a dashboard folder
+type Folder struct {
+	ID    int64  `json:"id"`
+	UID   string `json:"uid"`
+	Title string `json:"title"`
+}
+
+// Datasource is a grafana datasource
+type Datasource struct {
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	OrgID     int64  `json:"orgId"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Access    string `json:"access"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// GrafanaUser is a grafana user
+type GrafanaUser struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	Login          string `json:"login"`
+	Email          string `json:"email"`
+	IsGrafanaAdmin bool   `json:"isGrafanaAdmin"`
+	OrgID          int64  `json:"orgId,omitempty"`
+}
+
+// NewGrafanaUser is the user created by /api/admin/users
+type NewGrafanaUser struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	OrgID    int64  `json:"orgId,omitempty"`
+}
+
+// GrafanaOrg is a grafana organization
+type GrafanaOrg struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// GrafanaOrgUser is a user of an organization with its role, Viewer, Editor or Admin
+type GrafanaOrgUser struct {
+	OrgID  int64  `json:"orgId"`
+	UserID int64  `json:"userId"`
+	Login  string `json:"login"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// GrafanaHealth is the health reported by /api/health
+type GrafanaHealth struct {
+	Database string `json:"database"`
+	Version  string `json:"version"`
+	Commit   string `json:"commit"`
+}
+
+// NewGrafanaClient returns the client of the grafana of the hub authenticated as configured by
+// grafanaAuth in the options. If grafanaPortForward is set, the requests are sent through the
+// port forwarded to a grafana pod, which bypasses the oauth proxy. The forwarded port is shared by
+// all the grafana clients of the hub, the returned stop function is kept for the callers which
+// stop the clients of a specific pod
+func NewGrafanaClient(opt TestOptions) (*GrafanaClient, func(), error) {
+	client, err := newGrafanaClient(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, func() {}, nil
+}
+
+// newGrafanaClient returns the client of the grafana of the hub, which the clients of the
+// grafana API and of the metric queries sent to grafana are built from
+func newGrafanaClient(opt TestOptions) (*GrafanaClient, error) {
+	auth, err := NewGrafanaAuth(opt)
+	if err != nil {
+		return nil, err
+	}
+	if !opt.HubCluster.GrafanaPortForward {
+		return &GrafanaClient{
+			URL:        strings.TrimSuffix(GetGrafanaURL(opt), "/"),
+			Host:       opt.HubCluster.GrafanaHost,
+			Auth:       auth,
+			HTTPClient: newHTTPClient(),
+		}, nil
+	}
+
+	httpClient := newHTTPClient()
+	httpClient.Transport = &grafanaPortForwardTransport{opt: opt, forward: hubGrafanaPortForward}
+	return &GrafanaClient{
+		URL:        grafanaPortForwardURL,
+		Auth:       auth,
+		HTTPClient: httpClient,
+	}, nil
+}
+
+// grafanaPortForwardURL is the url of the grafana clients which send the requests through the
+// forwarded port, its host is replaced by the local address of the port
+const grafanaPortForwardURL = "http://127.0.0.1"
+
+// grafanaPortForward is a port forwarded to a ready grafana pod of the hub. The port is forwarded
+// by the first request, and again by the request following a failed one, e.g. once grafana is
+// restarted
+type grafanaPortForward struct {
+	mu   sync.Mutex
+	port int
+	stop func()
+}
+
+// hubGrafanaPortForward is shared by the grafana clients of the hub
+var hubGrafanaPortForward = &grafanaPortForward{}
+
+// localPort returns the local port forwarded to grafana, the port is forwarded if it is not yet
+func (f *grafanaPortForward) localPort(opt TestOptions) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.port != 0 {
+		return f.port, nil
+	}
+	pod, err := WaitForPodReady(opt, true, MCO_NAMESPACE, "app="+GrafanaLabel, time.Minute)
+	if err != nil {
+		return 0, err
+	}
+	port, stop, err := PortForward(opt, true, MCO_NAMESPACE, pod.Name, GrafanaHTTPPort)
+	if err != nil {
+		return 0, err
+	}
+	f.port, f.stop = port, stop
+	return port, nil
+}
+
+// reset stops the forwarding of the port if it is still the forwarded one
+func (f *grafanaPortForward) reset(port int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.port != port {
+		return
+	}
+	klog.V(3).Infof("stop forwarding 127.0.0.1:%d to grafana", port)
+	f.stop()
+	f.port, f.stop = 0, nil
+}
+
+// grafanaPortForwardTransport sends the requests to the local port forwarded to grafana
+type grafanaPortForwardTransport struct {
+	opt     TestOptions
+	forward *grafanaPortForward
+}
+
+func (t *grafanaPortForwardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	port, err := t.forward.localPort(t.opt)
+	if err != nil {
+		return nil, err
+	}
+	forwarded := req.Clone(req.Context())
+	forwarded.URL.Scheme = "http"
+	forwarded.URL.Host = fmt.Sprintf("127.0.0.1:%d", port)
+	forwarded.Host = ""
+	resp, err := http.DefaultTransport.RoundTrip(forwarded)
+	if err != nil {
+		t.forward.reset(port)
+	}
+	return resp, err
+}
+
+// newGrafanaPortForwardClient returns the client of the grafana of the pod through a forwarded port
+func newGrafanaPortForwardClient(opt TestOptions, pod string, auth HTTPAuth) (*GrafanaClient, func(), error) {
+	port, stop, err := PortForward(opt, true, MCO_NAMESPACE, pod, GrafanaHTTPPort)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &GrafanaClient{
+		URL:        fmt.Sprintf("http://127.0.0.1:%d", port),
+		Auth:       auth,
+		HTTPClient: newHTTPClient(),
+	}, stop, nil
+}
+
+// do sends the request to the API path, and decodes the response into data if it is not nil
+func (c *GrafanaClient) do(method, path string, params url.Values, body, data interface{}) error {
+	reqURL := strings.TrimSuffix(c.URL, "/") + path
+	if len(params) > 0 {
+		reqURL += "?" + params.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	klog.V(5).Infof("request url is: %s %s\n", method, reqURL)
+	req, err := http.NewRequest(method, reqURL, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Auth != nil {
+		c.Auth.Apply(req)
+	}
+	if c.Host != "" {
+		req.Host = c.Host
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	klog.V(5).Infof("response: %s\n", respBody)
+	if resp.StatusCode != http.StatusOK {
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(respBody, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(respBody))
+		}
+		return &GrafanaError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: message.Message}
+	}
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, data); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %v", path, err)
+	}
+	return nil
+}
+
+// Health returns the health of grafana and its database
+func (c *GrafanaClient) Health() (*GrafanaHealth, error) {
+	health := &GrafanaHealth{}
+	if err := c.do("GET", "/api/health", nil, nil, health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+// Search returns the dashboards and folders matching the query
+func (c *GrafanaClient) Search(query SearchQuery) ([]SearchHit, error) {
+	params := url.Values{}
+	if query.Query != "" {
+		params.Set("query", query.Query)
+	}
+	if query.Type != "" {
+		params.Set("type", query.Type)
+	}
+	for _, id := range query.FolderIDs {
+		params.Add("folderIds", strconv.FormatInt(id, 10))
+	}
+	for _, tag := range query.Tags {
+		params.Add("tag", tag)
+	}
+	hits := []SearchHit{}
+	if err := c.do("GET", "/api/search", params, nil, &hits); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// FindDashboard returns the dashboard with the exact title, or nil if there is none
+func (c *GrafanaClient) FindDashboard(title string) (*SearchHit, error) {
+	hits, err := c.Search(SearchQuery{Query: title, Type: "dash-db"})
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		if hits[i].Title == title {
+			return &hits[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Dashboard returns the dashboard with the uid and its metadata
+func (c *GrafanaClient) Dashboard(uid string) (*DashboardWithMeta, error) {
+	dashboard := &DashboardWithMeta{}
+	if err := c.do("GET", "/api/dashboards/uid/"+url.PathEscape(uid), nil, nil, dashboard); err != nil {
+		return nil, err
+	}
+	return dashboard, nil
+}
+
+// Folders returns the dashboard folders
+func (c *GrafanaClient) Folders() ([]Folder, error) {
+	folders := []Folder{}
+	if err := c.do("GET", "/api/folders", nil, nil, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// Folder returns the folder with the uid
+func (c *GrafanaClient) Folder(uid string) (*Folder, error) {
+	folder := &Folder{}
+	if err := c.do("GET", "/api/folders/"+url.PathEscape(uid), nil, nil, folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// Datasources returns the datasources, which requires the admin role
+func (c *GrafanaClient) Datasources() ([]Datasource, error) {
+	datasources := []Datasource{}
+	if err := c.do("GET", "/api/datasources", nil, nil, &datasources); err != nil {
+		return nil, err
+	}
+	return datasources, nil
+}
+
+// FrontendDatasources returns the datasources listed in the frontend settings sorted by name,
+// which unlike /api/datasources are readable by viewers
+func (c *GrafanaClient) FrontendDatasources() ([]Datasource, error) {
+	settings := struct {
+		Datasources map[string]Datasource `json:"datasources"`
+	}{}
+	if err := c.do("GET", "/api/frontend/settings", nil, nil, &settings); err != nil {
+		return nil, err
+	}
+	datasources := []Datasource{}
+	for name, datasource := range settings.Datasources {
+		datasource.Name = name
+		datasources = append(datasources, datasource)
+	}
+	sort.Slice(datasources, func(i, j int) bool { return datasources[i].Name < datasources[j].Name })
+	return datasources, nil
+}
+
+// DatasourceByName returns the datasource with the name
+func (c *GrafanaClient) DatasourceByName(name string) (*Datasource, error) {
+	datasource := &Datasource{}
+	if err := c.do("GET", "/api/datasources/name/"+url.PathEscape(name), nil, nil, datasource); err != nil {
+		return nil, err
+	}
+	return datasource, nil
+}
+
+// PrometheusClient returns the client of the prometheus datasource, the queries are sent through
+// the datasource proxy of grafana with the credentials and the transport of the grafana client
+func (c *GrafanaClient) PrometheusClient(datasource Datasource) *PrometheusClient {
+	return &PrometheusClient{
+		URL:        fmt.Sprintf("%s/api/datasources/proxy/%d", strings.TrimSuffix(c.URL, "/"), datasource.ID),
+		Host:       c.Host,
+		Auth:       c.Auth,
+		HTTPClient: c.HTTPClient,
+	}
+}
+
+// CheckDatasourceHealth checks the prometheus datasource answers a query through the
+// datasource proxy of grafana
+func (c *GrafanaClient) CheckDatasourceHealth(datasource Datasource) error {
+	if datasource.Type != "prometheus" {
+		return fmt.Errorf("health check of %s datasource %s is not supported", datasource.Type, datasource.Name)
+	}
+	if _, err := c.PrometheusClient(datasource).QueryVector("vector(1)"); err != nil {
+		return fmt.Errorf("datasource %s is not healthy: %v", datasource.Name, err)
+	}
+	return nil
+}
+
+// CurrentUser returns the user the requests are authenticated as
+func (c *GrafanaClient) CurrentUser() (*GrafanaUser, error) {
+	user := &GrafanaUser{}
+	if err := c.do("GET", "/api/user", nil, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LookupUser returns the user with the login or email
+func (c *GrafanaClient) LookupUser(loginOrEmail string) (*GrafanaUser, error) {
+	user := &GrafanaUser{}
+	params := url.Values{"loginOrEmail": []string{loginOrEmail}}
+	if err := c.do("GET", "/api/users/lookup", params, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Users returns every user, which requires the grafana admin
+func (c *GrafanaClient) Users() ([]GrafanaUser, error) {
+	users := []GrafanaUser{}
+	if err := c.do("GET", "/api/users", nil, nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CurrentOrg returns the organization of the current user
+func (c *GrafanaClient) CurrentOrg() (*GrafanaOrg, error) {
+	org := &GrafanaOrg{}
+	if err := c.do("GET", "/api/org", nil, nil, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// Orgs returns every organization, which requires the grafana admin
+func (c *GrafanaClient) Orgs() ([]GrafanaOrg, error) {
+	orgs := []GrafanaOrg{}
+	if err := c.do("GET", "/api/orgs", nil, nil, &orgs); err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// OrgUsers returns the users of the current organization with their roles
+func (c *GrafanaClient) OrgUsers() ([]GrafanaOrgUser, error) {
+	users := []GrafanaOrgUser{}
+	if err := c.do("GET", "/api/org/users", nil, nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdateOrgUserRole changes the role of the user in the current organization
+func (c *GrafanaClient) UpdateOrgUserRole(userID int64, role string) error {
+	body := map[string]string{"role": role}
+	return c.do("PATCH", fmt.Sprintf("/api/org/users/%d", userID), nil, body, nil)
+}
+
+// CreateUser creates the user with the admin API and returns its id
+func (c *GrafanaClient) CreateUser(user NewGrafanaUser) (int64, error) {
+	data := struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := c.do("POST", "/api/admin/users", nil, user, &data); err != nil {
+		return 0, err
+	}
+	return data.ID, nil
+}
+
+// DeleteUser deletes the user with the admin API
+func (c *GrafanaClient) DeleteUser(userID int64) error {
+	return c.do("DELETE", fmt.Sprintf("/api/admin/users/%d", userID), nil, nil, nil)
+}
+
+// SetGrafanaAdmin grants or revokes the grafana admin permission of the user
+func (c *GrafanaClient) SetGrafanaAdmin(userID int64, isGrafanaAdmin bool) error {
+	body := map[string]bool{"isGrafanaAdmin": isGrafanaAdmin}
+	return c.do("PUT", fmt.Sprintf("/api/admin/users/%d/permissions", userID), nil, body, nil)
+}
+
+// AdminSettings returns the settings of grafana by section, which requires the grafana admin
+func (c *GrafanaClient) AdminSettings() (map[string]map[string]string, error) {
+	settings := map[string]map[string]string{}
+	if err := c.do("GET", "/api/admin/settings", nil, nil, &settings); err != nil {
+		return nil, err
 	}
-	return grafanaConsoleURL
+	return settings, nil
 }
@@ -0,0 +1,251 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	GrafanaDevName = MCO_CR_NAME + "-grafana-dev"
+	// GrafanaDevLabel is the app label of the grafana-dev pods
+	GrafanaDevLabel = GrafanaLabel + "-dev"
+	// GrafanaHTTPPort is the port grafana listens on behind the oauth proxy
+	GrafanaHTTPPort = 3001
+	// GrafanaCustomDashboardLabel marks the configmaps the dashboard loader loads into grafana
+	GrafanaCustomDashboardLabel = "grafana-custom-dashboard"
+	// GrafanaDashboardFolderAnnotation is the folder the dashboard of the configmap is loaded into
+	GrafanaDashboardFolderAnnotation = "observability.open-cluster-management.io/dashboard-folder"
+)
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// GrafanaDevStepError is the failure of a step of the grafana-dev scenario
+type GrafanaDevStepError struct {
+	Step string
+	Err  error
+}
+
+func (e *GrafanaDevStepError) Error() string {
+	return fmt.Sprintf("grafana-dev step %q failed: %v", e.Step, e.Err)
+}
+
+func grafanaDevStep(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &GrafanaDevStepError{Step: step, Err: err}
+}
+
+// newGrafanaDevDeployment returns the grafana-dev deployment, a single replica copy of the grafana
+// deployment without the oauth proxy which is not managed by the operator
+func newGrafanaDevDeployment(grafana *appv1.Deployment) *appv1.Deployment {
+	replicas := int32(1)
+	labels := map[string]string{"app": GrafanaDevLabel}
+	dev := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GrafanaDevName,
+			Namespace: grafana.Namespace,
+			Labels:    labels,
+		},
+		Spec: *grafana.Spec.DeepCopy(),
+	}
+	dev.Spec.Replicas = &replicas
+	dev.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	dev.Spec.Template.Labels = labels
+
+	containers := []corev1.Container{}
+	for _, container := range dev.Spec.Template.Spec.Containers {
+		if !strings.Contains(container.Name, "proxy") {
+			containers = append(containers, container)
+		}
+	}
+	dev.Spec.Template.Spec.Containers = containers
+	return dev
+}
+
+// DeployGrafanaDev creates the grafana-dev deployment from the grafana deployment of the hub
+func DeployGrafanaDev(opt TestOptions) error {
+	err, grafana := GetDeployment(opt, true, MCO_CR_NAME+"-grafana", MCO_NAMESPACE)
+	if err != nil {
+		return err
+	}
+	clientKube := getKubeClient(opt, true)
+	_, err = clientKube.AppsV1().Deployments(MCO_NAMESPACE).Create(newGrafanaDevDeployment(grafana))
+	if errors.IsAlreadyExists(err) {
+		klog.V(1).Infof("deployment %s already exists", GrafanaDevName)
+		return nil
+	}
+	return err
+}
+
+// CleanGrafanaDev deletes the grafana-dev deployment and its pods
+func CleanGrafanaDev(opt TestOptions) error {
+	clientKube := getKubeClient(opt, true)
+	propagation := metav1.DeletePropagationForeground
+	err := clientKube.AppsV1().Deployments(MCO_NAMESPACE).Delete(GrafanaDevName, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		klog.Errorf("Failed to delete deployment %s in namespace %s due to %v", GrafanaDevName, MCO_NAMESPACE, err)
+		return err
+	}
+	return nil
+}
+
+// NewGrafanaDevClient returns the client of the grafana of the pod through a forwarded port, the
+// requests are authenticated as the grafana admin
+func NewGrafanaDevClient(opt TestOptions, pod string) (*GrafanaClient, func(), error) {
+	return newGrafanaPortForwardClient(opt, pod, HeaderAuth{Name: GrafanaForwardedUserHeader, Value: GrafanaAdminUser})
+}
+
+// SwitchToGrafanaAdmin makes the user a grafana admin and an admin of its organization
+func SwitchToGrafanaAdmin(client *GrafanaClient, login string) error {
+	user, err := client.LookupUser(login)
+	if err != nil {
+		return err
+	}
+	if err := client.SetGrafanaAdmin(user.ID, true); err != nil {
+		return err
+	}
+	if err := client.UpdateOrgUserRole(user.ID, "Admin"); err != nil {
+		return err
+	}
+
+	user, err = client.LookupUser(login)
+	if err != nil {
+		return err
+	}
+	if !user.IsGrafanaAdmin {
+		return fmt.Errorf("user %s is not a grafana admin", login)
+	}
+	orgUsers, err := client.OrgUsers()
+	if err != nil {
+		return err
+	}
+	for _, orgUser := range orgUsers {
+		if orgUser.UserID == user.ID && orgUser.Role != "Admin" {
+			return fmt.Errorf("user %s has role %s instead of Admin", login, orgUser.Role)
+		}
+	}
+	return nil
+}
+
+// DashboardConfigMapName returns the name of the configmap a dashboard is exported to
+func DashboardConfigMapName(title string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
+
+// ExportDashboardConfigMap exports the dashboard with the title to a configmap the dashboard loader
+// can load, the dashboard keeps its uid and folder
+func ExportDashboardConfigMap(client *GrafanaClient, title string) (*corev1.ConfigMap, error) {
+	hit, err := client.FindDashboard(title)
+	if err != nil {
+		return nil, err
+	}
+	if hit == nil {
+		return nil, fmt.Errorf("dashboard %s not found", title)
+	}
+	dashboard, err := client.Dashboard(hit.UID)
+	if err != nil {
+		return nil, err
+	}
+	// the id is assigned by the grafana the dashboard is loaded into
+	delete(dashboard.Dashboard, "id")
+	data, err := json.MarshalIndent(dashboard.Dashboard, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	name := DashboardConfigMapName(title)
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: MCO_NAMESPACE,
+			Labels:    map[string]string{GrafanaCustomDashboardLabel: "true"},
+		},
+		Data: map[string]string{name + ".json": string(data)},
+	}
+	if folder := dashboard.Meta.FolderTitle; folder != "" && folder != "General" {
+		cm.Annotations = map[string]string{GrafanaDashboardFolderAnnotation: folder}
+	}
+	return cm, nil
+}
+
+// GrafanaDevScenario deploys grafana-dev, creates a user and switches it to admin, and exports a
+// dashboard, which is expected to be loaded by the dashboard loader of grafana-dev
+type GrafanaDevScenario struct {
+	DashboardTitle string
+	User           NewGrafanaUser
+	Timeout        time.Duration
+
+	// ConfigMap is the exported dashboard
+	ConfigMap *corev1.ConfigMap
+}
+
+// Run runs the steps of the scenario, the first failing step is returned as a GrafanaDevStepError.
+// grafana-dev is not cleaned up, which is left to Clean
+func (s *GrafanaDevScenario) Run(opt TestOptions) error {
+	if err := grafanaDevStep("deploy", DeployGrafanaDev(opt)); err != nil {
+		return err
+	}
+	pod, err := WaitForPodReady(opt, true, MCO_NAMESPACE, "app="+GrafanaDevLabel, s.Timeout)
+	if err := grafanaDevStep("wait for readiness", err); err != nil {
+		return err
+	}
+	client, stop, err := NewGrafanaDevClient(opt, pod.Name)
+	if err := grafanaDevStep("connect", err); err != nil {
+		return err
+	}
+	defer stop()
+
+	if err := grafanaDevStep("wait for grafana", s.poll(func() error {
+		health, err := client.Health()
+		if err == nil && health.Database != "ok" {
+			err = fmt.Errorf("database is %s", health.Database)
+		}
+		return err
+	})); err != nil {
+		return err
+	}
+	_, err = client.CreateUser(s.User)
+	if err := grafanaDevStep("create user", err); err != nil {
+		return err
+	}
+	if err := grafanaDevStep("switch to grafana admin", SwitchToGrafanaAdmin(client, s.User.Login)); err != nil {
+		return err
+	}
+	// the dashboard loader of grafana-dev loads the dashboards after grafana is ready
+	return grafanaDevStep("export dashboard", s.poll(func() error {
+		cm, err := ExportDashboardConfigMap(client, s.DashboardTitle)
+		s.ConfigMap = cm
+		return err
+	}))
+}
+
+func (s *GrafanaDevScenario) poll(f func() error) error {
+	deadline := time.Now().Add(s.Timeout)
+	for {
+		err := f()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		klog.V(3).Infof("retrying: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// Clean deletes grafana-dev
+func (s *GrafanaDevScenario) Clean(opt TestOptions) error {
+	return grafanaDevStep("clean", CleanGrafanaDev(opt))
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewGrafanaDevDeployment(t *testing.T) {
+	replicas := int32(2)
+	labels := map[string]string{"app": "multicluster-observability-grafana"}
+	grafana := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            MCO_CR_NAME + "-grafana",
+			Namespace:       MCO_NAMESPACE,
+			Labels:          labels,
+			ResourceVersion: "42",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "MultiClusterObservability", Name: "observability"}},
+		},
+		Spec: appv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "grafana"}, {Name: "grafana-dashboard-loader"}, {Name: "grafana-proxy"},
+				}},
+			},
+		},
+	}
+
+	dev := newGrafanaDevDeployment(grafana)
+	assert.Equal(t, GrafanaDevName, dev.Name)
+	assert.Empty(t, dev.ResourceVersion)
+	assert.Empty(t, dev.OwnerReferences, "grafana-dev is not managed by the operator")
+	assert.Equal(t, int32(1), *dev.Spec.Replicas)
+	assert.Equal(t, GrafanaDevLabel, dev.Spec.Selector.MatchLabels["app"])
+	assert.Equal(t, GrafanaDevLabel, dev.Spec.Template.Labels["app"])
+	require.Len(t, dev.Spec.Template.Spec.Containers, 2)
+	assert.Equal(t, "grafana-dashboard-loader", dev.Spec.Template.Spec.Containers[1].Name)
+	assert.Len(t, grafana.Spec.Template.Spec.Containers, 3, "the grafana deployment is not modified")
+	assert.Equal(t, "multicluster-observability-grafana", grafana.Spec.Template.Labels["app"])
+}
+
+func TestExportDashboardConfigMap(t *testing.T) {
+	server := newFakeGrafana(t, map[int64]NewGrafanaUser{})
+	defer server.Close()
+	client := &GrafanaClient{URL: server.URL, Auth: HeaderAuth{Name: GrafanaForwardedUserHeader, Value: GrafanaAdminUser}}
+
+	assert.Equal(t, "sample-dashboard-for-e2e", DashboardConfigMapName("Sample Dashboard for E2E"))
+	assert.Equal(t, "cpu-memory-usage", DashboardConfigMapName(" CPU / Memory usage "))
+
+	cm, err := ExportDashboardConfigMap(client, "Sample Dashboard")
+	require.NoError(t, err)
+	assert.Equal(t, "sample-dashboard", cm.Name)
+	assert.Equal(t, MCO_NAMESPACE, cm.Namespace)
+	assert.Equal(t, "true", cm.Labels[GrafanaCustomDashboardLabel])
+	assert.Equal(t, "Custom", cm.Annotations[GrafanaDashboardFolderAnnotation])
+	assert.JSONEq(t, `{"uid":"def","title":"Sample Dashboard","panels":[]}`, cm.Data["sample-dashboard.json"])
+}
+
+func TestIsPodReady(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "grafana"}, {Name: "grafana-dashboard-loader"}}},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "grafana", Ready: true}},
+		},
+	}
+	assert.False(t, isPodReady(pod))
+	pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{Name: "grafana-dashboard-loader", Ready: true})
+	assert.True(t, isPodReady(pod))
+	pod.Status.Phase = corev1.PodPending
+	assert.False(t, isPodReady(pod))
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeGrafana serves the search, dashboard, datasource and admin endpoints of the Grafana API
+// to the grafana admin only
+func newFakeGrafana(t *testing.T, users map[int64]NewGrafanaUser) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(GrafanaForwardedUserHeader) != GrafanaAdminUser {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"Unauthorized"}`)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/search":
+			assert.Equal(t, "dash-db", r.URL.Query().Get("type"))
+			assert.Equal(t, "Sample Dashboard", r.URL.Query().Get("query"))
+			fmt.Fprint(w, `[{"id":2,"uid":"abc","title":"Sample Dashboard for E2E","type":"dash-db","folderId":1,"folderTitle":"Custom"},
+				{"id":3,"uid":"def","title":"Sample Dashboard","type":"dash-db","folderId":1,"folderUid":"f1","folderTitle":"Custom"}]`)
+		case r.Method == "GET" && r.URL.Path == "/api/dashboards/uid/def":
+			fmt.Fprint(w, `{"dashboard":{"id":3,"uid":"def","title":"Sample Dashboard","panels":[]},
+				"meta":{"slug":"sample-dashboard","version":4,"folderId":1,"folderUid":"f1","folderTitle":"Custom"}}`)
+		case r.Method == "GET" && r.URL.Path == "/api/dashboards/uid/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Dashboard not found"}`)
+		case r.Method == "GET" && r.URL.Path == "/api/frontend/settings":
+			fmt.Fprint(w, `{"datasources":{"Observatorium":{"id":1,"uid":"o1","type":"prometheus","url":"/api/datasources/proxy/1"},
+				"-- Grafana --":{"id":-1,"type":"datasource"}}}`)
+		case r.Method == "GET" && r.URL.Path == "/api/datasources/proxy/1/api/v1/query":
+			assert.Equal(t, "vector(1)", r.URL.Query().Get("query"))
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1617000000,"1"]}]}}`)
+		case r.Method == "POST" && r.URL.Path == "/api/admin/users":
+			user := NewGrafanaUser{}
+			if err := json.NewDecoder(r.Body).Decode(&user); !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			users[7] = user
+			fmt.Fprint(w, `{"id":7,"message":"User created"}`)
+		case r.Method == "PUT" && r.URL.Path == "/api/admin/users/7/permissions":
+			permissions := map[string]bool{}
+			if err := json.NewDecoder(r.Body).Decode(&permissions); !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			assert.True(t, permissions["isGrafanaAdmin"])
+			fmt.Fprint(w, `{"message":"User permissions updated"}`)
+		case r.Method == "PATCH" && r.URL.Path == "/api/org/users/7":
+			role := map[string]string{}
+			if err := json.NewDecoder(r.Body).Decode(&role); !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			assert.Equal(t, "Admin", role["role"])
+			fmt.Fprint(w, `{"message":"Organization user updated"}`)
+		case r.Method == "DELETE" && r.URL.Path == "/api/admin/users/7":
+			delete(users, 7)
+			fmt.Fprint(w, `{"message":"User deleted"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "404 page not found")
+		}
+	}))
+}
+
+func TestGrafanaClient(t *testing.T) {
+	users := map[int64]NewGrafanaUser{}
+	server := newFakeGrafana(t, users)
+	defer server.Close()
+	client := &GrafanaClient{URL: server.URL + "/", Auth: HeaderAuth{Name: GrafanaForwardedUserHeader, Value: GrafanaAdminUser}}
+
+	hit, err := client.FindDashboard("Sample Dashboard")
+	require.NoError(t, err)
+	require.NotNil(t, hit, "the exact title is matched")
+	assert.Equal(t, "def", hit.UID)
+	assert.Equal(t, "Custom", hit.FolderTitle)
+
+	dashboard, err := client.Dashboard(hit.UID)
+	require.NoError(t, err)
+	assert.Equal(t, "Sample Dashboard", dashboard.Dashboard["title"])
+	assert.Equal(t, int64(4), dashboard.Meta.Version)
+	assert.Equal(t, "f1", dashboard.Meta.FolderUID)
+
+	_, err = client.Dashboard("missing")
+	assert.True(t, IsGrafanaNotFound(err))
+	assert.EqualError(t, err, "GET /api/dashboards/uid/missing failed with status code 404: Dashboard not found")
+
+	datasources, err := client.FrontendDatasources()
+	require.NoError(t, err)
+	require.Len(t, datasources, 2)
+	assert.Equal(t, Datasource{ID: 1, UID: "o1", Name: "Observatorium", Type: "prometheus", URL: "/api/datasources/proxy/1"}, datasources[1])
+	assert.NoError(t, client.CheckDatasourceHealth(datasources[1]))
+	assert.Error(t, client.CheckDatasourceHealth(Datasource{ID: 2, Name: "Observatorium", Type: "prometheus"}))
+	assert.Error(t, client.CheckDatasourceHealth(Datasource{ID: 3, Name: "Loki", Type: "loki"}))
+
+	id, err := client.CreateUser(NewGrafanaUser{Name: "e2e", Login: "e2e", Email: "e2e@example.com", Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+	assert.Equal(t, "e2e", users[7].Login)
+	assert.NoError(t, client.SetGrafanaAdmin(id, true))
+	assert.NoError(t, client.UpdateOrgUserRole(id, "Admin"))
+	assert.NoError(t, client.DeleteUser(id))
+	assert.Empty(t, users)
+
+	_, err = (&GrafanaClient{URL: server.URL}).Search(SearchQuery{})
+	assert.EqualError(t, err, "GET /api/search failed with status code 401: Unauthorized")
+}
+
+func TestNewGrafanaAuth(t *testing.T) {
+	defer setEnv("IS_CANARY_ENV", "")()
+	req := func(auth HTTPAuth) *http.Request {
+		r := httptest.NewRequest("GET", "/api/health", nil)
+		if auth != nil {
+			auth.Apply(r)
+		}
+		return r
+	}
+
+	auth, err := NewGrafanaAuth(TestOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, GrafanaAdminUser, req(auth).Header.Get(GrafanaForwardedUserHeader), "the oauth proxy is bypassed by default")
+
+	auth, err = NewGrafanaAuth(TestOptions{GrafanaAuth: GrafanaAuth{Mode: GrafanaAuthForwardedUser, User: "kube:admin"}})
+	require.NoError(t, err)
+	assert.Equal(t, "kube:admin", req(auth).Header.Get(GrafanaForwardedUserHeader))
+
+	os.Setenv("IS_CANARY_ENV", "true")
+	assert.Equal(t, GrafanaAuthBearer, ResolveGrafanaAuth(TestOptions{}).Mode)
+	auth, err = NewGrafanaAuth(TestOptions{GrafanaAuth: GrafanaAuth{BearerToken: "test-token"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer test-token", req(auth).Header.Get("Authorization"))
+
+	auth, err = NewGrafanaAuth(TestOptions{GrafanaAuth: GrafanaAuth{Mode: GrafanaAuthBasic, Username: "admin", Password: "secret"}})
+	require.NoError(t, err)
+	username, password, ok := req(auth).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "admin", username)
+	assert.Equal(t, "secret", password)
+	_, err = NewGrafanaAuth(TestOptions{GrafanaAuth: GrafanaAuth{Mode: GrafanaAuthBasic}})
+	assert.Error(t, err)
+
+	auth, err = NewGrafanaAuth(TestOptions{GrafanaAuth: GrafanaAuth{Mode: GrafanaAuthNone}})
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+	_, err = NewGrafanaAuth(TestOptions{GrafanaAuth: GrafanaAuth{Mode: "oauth"}})
+	assert.Error(t, err)
+}
+
+func TestGetGrafanaURL(t *testing.T) {
+	opt := TestOptions{HubCluster: Cluster{BaseDomain: "example.com"}}
+	assert.Equal(t, "https://multicloud-console.apps.example.com/grafana/", GetGrafanaURL(opt))
+
+	opt.HubCluster.GrafanaURL = "http://localhost/grafana"
+	opt.HubCluster.GrafanaHost = "grafana.local"
+	client, stop, err := NewGrafanaClient(opt)
+	require.NoError(t, err)
+	defer stop()
+	assert.Equal(t, "http://localhost/grafana", client.URL)
+	assert.Equal(t, "grafana.local", client.Host)
+}
+
+func TestGrafanaPortForwardTransport(t *testing.T) {
+	server := newFakeGrafana(t, map[int64]NewGrafanaUser{})
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	stopped := 0
+	forward := &grafanaPortForward{port: port, stop: func() { stopped++ }}
+	httpClient := newHTTPClient()
+	httpClient.Transport = &grafanaPortForwardTransport{forward: forward}
+	grafana := &GrafanaClient{
+		URL:        grafanaPortForwardURL,
+		Auth:       HeaderAuth{Name: GrafanaForwardedUserHeader, Value: GrafanaAdminUser},
+		HTTPClient: httpClient,
+	}
+
+	datasources, err := grafana.FrontendDatasources()
+	require.NoError(t, err)
+	require.Len(t, datasources, 2)
+	assert.NoError(t, grafana.CheckDatasourceHealth(datasources[1]), "the metric queries share the forwarded port")
+	assert.Equal(t, 0, stopped)
+
+	server.Close()
+	_, err = grafana.FrontendDatasources()
+	assert.Error(t, err)
+	assert.Equal(t, 1, stopped, "the port is forwarded again after a failed request")
+	assert.Equal(t, 0, forward.port)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	MetricsCollectorDeploymentName = "metrics-collector-deployment"
+	metricsCollectorIntervalArg    = "--interval="
+	// spacingTolerance is the deviation of the median sample spacing allowed from the interval
+	spacingTolerance = 0.25
+)
+
+// CheckMetricsCollectorInterval checks the metrics-collector is rolled out with the interval argument
+func CheckMetricsCollectorInterval(opt TestOptions, isHub bool, interval time.Duration) error {
+	err, dep := GetDeployment(opt, isHub, MetricsCollectorDeploymentName, MCO_ADDON_NAMESPACE)
+	if err != nil {
+		return err
+	}
+
+	var actual string
+	for _, container := range dep.Spec.Template.Spec.Containers {
+		for _, arg := range container.Args {
+			if strings.HasPrefix(arg, metricsCollectorIntervalArg) {
+				actual = strings.TrimPrefix(arg, metricsCollectorIntervalArg)
+			}
+		}
+	}
+	d, err := time.ParseDuration(actual)
+	if err != nil {
+		return fmt.Errorf("failed to parse the interval argument %q of %s: %v", actual, MetricsCollectorDeploymentName, err)
+	}
+	if d != interval {
+		return fmt.Errorf("%s has interval %s instead of %s", MetricsCollectorDeploymentName, d, interval)
+	}
+
+	if status := deploymentRolloutStatus(dep); !status.complete {
+		return fmt.Errorf("%s is not rolled out yet: %s", MetricsCollectorDeploymentName, status.progress)
+	}
+	return nil
+}
+
+// CheckSampleSpacing checks the samples of the series selector are stored every interval between start and end,
+// without gaps or duplicates
+func CheckSampleSpacing(opt TestOptions, selector string, start, end time.Time, interval time.Duration) error {
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err
+	}
+	matrix, err := client.QueryRawSamples(selector, start, end)
+	if err != nil {
+		return err
+	}
+	if len(matrix) == 0 {
+		return fmt.Errorf("no data found for %s between %s and %s", selector,
+			start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	problems := []string{}
+	minSpacing := time.Duration(float64(interval) * (1 - spacingTolerance))
+	maxSpacing := time.Duration(float64(interval) * (1 + spacingTolerance))
+	for _, report := range (GapAnalysis{Interval: interval}).Analyze(matrix) {
+		klog.V(1).Infof("sample spacing of %s", report)
+		if report.HasDataLoss() || len(report.Duplicates) > 0 ||
+			report.MedianSpacing < minSpacing || report.MedianSpacing > maxSpacing {
+			problems = append(problems, report.String())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("samples of %s are not collected every %s: %s", selector, interval, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -31,3 +31,21 @@ func UpdateObservabilityFromManagedCluster(opt TestOptions, enableObservability
 	}
 	return nil
 }
+
+// ListObservabilityEnabledClusters returns the names of the managed clusters which are not
+// labelled with observability=disabled
+func ListObservabilityEnabledClusters(opt TestOptions) ([]string, error) {
+	clientDynamic := GetKubeClientDynamic(opt, true)
+	clusters, err := clientDynamic.Resource(NewOCMManagedClustersGVR()).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, cluster := range clusters.Items {
+		if cluster.GetLabels()["observability"] == "disabled" {
+			continue
+		}
+		names = append(names, cluster.GetName())
+	}
+	return names, nil
+}
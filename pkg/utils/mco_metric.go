@@ -4,77 +4,288 @@
 package utils
 
 import (
-	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"k8s.io/klog"
 )
 
-func ContainManagedClusterMetric(opt TestOptions, query string, matchedLabels []string) (error, bool) {
-	grafanaConsoleURL := GetGrafanaURL(opt)
-	path := "/api/datasources/proxy/1/api/v1/query?"
-	// TODO(morvencao): remove this after accessing metrics from grafana url with bearer token is supported
-	if os.Getenv("IS_CANARY_ENV") != "true" && os.Getenv("THANOS_QUERY_FRONTEND_URL") != "" {
-		grafanaConsoleURL = os.Getenv("THANOS_QUERY_FRONTEND_URL")
-		path = "/api/v1/query?"
-	}
-	queryParams := url.PathEscape(fmt.Sprintf("query=%s", query))
-	klog.V(5).Infof("request url is: %s\n", grafanaConsoleURL+path+queryParams)
-	req, err := http.NewRequest(
-		"GET",
-		grafanaConsoleURL+path+queryParams,
-		nil)
+// PrometheusClient queries the Prometheus HTTP API, which is served by the thanos query
+// frontend, the rbac-query-proxy and proxied by grafana
+type PrometheusClient struct {
+	// URL is the prefix of the /api/v1 endpoints, e.g. https://grafana/api/datasources/proxy/1
+	URL string
+	// Host overrides the Host header of the requests if set
+	Host       string
+	Auth       HTTPAuth
+	HTTPClient *http.Client
+}
+
+// QueryError is the error reported by the Prometheus HTTP API
+type QueryError struct {
+	StatusCode int
+	ErrorType  string
+	Err        string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query failed with status code %d: %s: %s", e.StatusCode, e.ErrorType, e.Err)
+}
+
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+type queryData struct {
+	ResultType model.ValueType `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// NewPrometheusClient returns the client for the query endpoint configured in the options
+func NewPrometheusClient(opt TestOptions) (*PrometheusClient, error) {
+	return NewPrometheusClientForEndpoint(opt, ResolveQueryEndpoint(opt))
+}
+
+// get sends a GET request to the API path and decodes the data of the response into data
+func (c *PrometheusClient) get(path string, params url.Values, data interface{}) error {
+	reqURL := strings.TrimSuffix(c.URL, "/") + path + "?" + params.Encode()
+	klog.V(5).Infof("request url is: %s\n", reqURL)
+	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
-		return err, false
+		return err
+	}
+	if c.Auth != nil {
+		c.Auth.Apply(req)
+	}
+	if c.Host != "" {
+		req.Host = c.Host
 	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	client := c.HTTPClient
+	if client == nil {
+		client = newHTTPClient()
 	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-	client := &http.Client{Transport: tr}
-	token, err := FetchBearerToken(opt)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err, false
+		return err
 	}
-	if token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
+	klog.V(5).Infof("response: %s\n", body)
+
+	result := &apiResponse{}
+	if err := json.Unmarshal(body, result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &QueryError{StatusCode: resp.StatusCode, ErrorType: "unknown", Err: http.StatusText(resp.StatusCode)}
+		}
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	if result.Status != "success" {
+		return &QueryError{StatusCode: resp.StatusCode, ErrorType: result.ErrorType, Err: result.Error}
+	}
+	for _, warning := range result.Warnings {
+		klog.V(1).Infof("query warning: %s", warning)
 	}
-	req.Host = opt.HubCluster.GrafanaHost
+	return json.Unmarshal(result.Data, data)
+}
 
-	resp, err := client.Do(req)
+// Query runs an instant query, the query is evaluated at the current server time if ts is zero
+func (c *PrometheusClient) Query(query string, ts time.Time) (model.Value, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	if !ts.IsZero() {
+		params.Set("time", formatTime(ts))
+	}
+
+	data := &queryData{}
+	if err := c.get("/api/v1/query", params, data); err != nil {
+		return nil, err
+	}
+	return decodeQueryResult(data)
+}
+
+// QueryVector runs an instant query which is expected to return an instant vector
+func (c *PrometheusClient) QueryVector(query string) (model.Vector, error) {
+	value, err := c.Query(query, time.Time{})
 	if err != nil {
-		return err, false
+		return nil, err
+	}
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("query %s returned %s instead of vector", query, value.Type())
 	}
+	return vector, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		klog.Errorf("resp.StatusCode: %v\n", resp.StatusCode)
-		return fmt.Errorf("Failed to access managed cluster metrics via grafana console"), false
+// QueryRange runs a range query, the query is evaluated at every step between start and end
+func (c *PrometheusClient) QueryRange(query string, start, end time.Time, step time.Duration) (model.Matrix, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	data := &queryData{}
+	if err := c.get("/api/v1/query_range", params, data); err != nil {
+		return nil, err
+	}
+	value, err := decodeQueryResult(data)
+	if err != nil {
+		return nil, err
+	}
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("range query %s returned %s instead of matrix", query, value.Type())
 	}
+	return matrix, nil
+}
 
-	metricResult, err := ioutil.ReadAll(resp.Body)
-	klog.V(5).Infof("metricResult: %s\n", metricResult)
+// QueryRawSamples returns the samples stored for the series selector between start and end.
+// Unlike QueryRange, the samples are not aligned to steps, so they can be used to find gaps
+func (c *PrometheusClient) QueryRawSamples(selector string, start, end time.Time) (model.Matrix, error) {
+	query := fmt.Sprintf("%s[%ds]", selector, int64(end.Sub(start).Seconds()))
+	value, err := c.Query(query, end)
 	if err != nil {
-		return err, false
+		return nil, err
+	}
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("query %s returned %s instead of matrix", query, value.Type())
 	}
+	return matrix, nil
+}
+
+func decodeQueryResult(data *queryData) (model.Value, error) {
+	switch data.ResultType {
+	case model.ValVector:
+		vector := model.Vector{}
+		err := json.Unmarshal(data.Result, &vector)
+		return vector, err
+	case model.ValMatrix:
+		matrix := model.Matrix{}
+		err := json.Unmarshal(data.Result, &matrix)
+		return matrix, err
+	case model.ValScalar:
+		scalar := &model.Scalar{}
+		err := json.Unmarshal(data.Result, scalar)
+		return scalar, err
+	case model.ValString:
+		str := &model.String{}
+		err := json.Unmarshal(data.Result, str)
+		return str, err
+	default:
+		return nil, fmt.Errorf("unexpected result type %s", data.ResultType)
+	}
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+}
+
+// SampleMatcher reports whether a sample meets a condition
+type SampleMatcher func(*model.Sample) bool
+
+// HasLabels matches the samples with all the given label values
+func HasLabels(labels map[string]string) SampleMatcher {
+	return func(s *model.Sample) bool {
+		for name, value := range labels {
+			if string(s.Metric[model.LabelName(name)]) != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ValueGreaterThan matches the samples with a value greater than n
+func ValueGreaterThan(n float64) SampleMatcher {
+	return func(s *model.Sample) bool {
+		return float64(s.Value) > n
+	}
+}
+
+// ValueLessThan matches the samples with a value less than n
+func ValueLessThan(n float64) SampleMatcher {
+	return func(s *model.Sample) bool {
+		return float64(s.Value) < n
+	}
+}
+
+// ValueEquals matches the samples with a value equal to n
+func ValueEquals(n float64) SampleMatcher {
+	return func(s *model.Sample) bool {
+		return float64(s.Value) == n
+	}
+}
 
-	if !strings.Contains(string(metricResult), `"status":"success"`) {
-		return fmt.Errorf("Failed to find valid status from response"), false
+// FilterSamples returns the samples of the vector which match all the matchers
+func FilterSamples(vector model.Vector, matchers ...SampleMatcher) model.Vector {
+	matched := model.Vector{}
+	for _, sample := range vector {
+		ok := true
+		for _, matcher := range matchers {
+			if !matcher(sample) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, sample)
+		}
 	}
+	return matched
+}
+
+// ContainsSample reports whether any sample of the vector matches all the matchers
+func ContainsSample(vector model.Vector, matchers ...SampleMatcher) bool {
+	return len(FilterSamples(vector, matchers...)) > 0
+}
 
-	contained := true
-	for _, label := range matchedLabels {
-		if !strings.Contains(string(metricResult), label) {
-			contained = false
-			break
+// parseLabelFragments converts label fragments like `"__name__":"ALERTS"` into a label map
+func parseLabelFragments(fragments []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, fragment := range fragments {
+		if err := json.Unmarshal([]byte("{"+fragment+"}"), &labels); err != nil {
+			return nil, fmt.Errorf("invalid label fragment %s: %v", fragment, err)
 		}
 	}
-	if !contained {
+	return labels, nil
+}
+
+func ContainManagedClusterMetric(opt TestOptions, query string, matchedLabels []string) (error, bool) {
+	labels, err := parseLabelFragments(matchedLabels)
+	if err != nil {
+		return err, false
+	}
+
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err, false
+	}
+
+	value, err := client.Query(query, time.Time{})
+	if err != nil {
+		klog.Errorf("Failed to access managed cluster metrics: %v\n", err)
+		return err, false
+	}
+
+	vector, ok := value.(model.Vector)
+	if !ok || !ContainsSample(vector, HasLabels(labels)) {
 		return fmt.Errorf("Failed to find metric name from response"), false
 	}
 
@@ -0,0 +1,155 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// GapAnalysis finds the gaps, duplicate samples and counter resets in series
+type GapAnalysis struct {
+	// Interval is the expected distance between two samples
+	Interval time.Duration
+	// GapFactor is the number of intervals two samples can be apart before it is
+	// reported as a gap, defaults to 2
+	GapFactor float64
+	// Start and End are the optional edges of the analyzed window, missing samples
+	// at the beginning or the end of the window are reported as gaps if set
+	Start time.Time
+	End   time.Time
+}
+
+// Gap is a period without samples
+type Gap struct {
+	From model.Time
+	To   model.Time
+}
+
+// Duration returns the length of the gap
+func (g Gap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+// SeriesReport is the result of the analysis of one series
+type SeriesReport struct {
+	Metric  model.Metric
+	Samples int
+	Gaps    []Gap
+	// MedianSpacing is the median distance between two consecutive samples
+	MedianSpacing time.Duration
+	// Duplicates are the timestamps of samples written less than half an interval
+	// after the previous one, which happens when the same data is sent twice
+	Duplicates []model.Time
+	// CounterResets are the timestamps of samples lower than the previous one,
+	// they are only meaningful for counters
+	CounterResets []model.Time
+}
+
+// HasDataLoss reports whether there are gaps in the series
+func (r SeriesReport) HasDataLoss() bool {
+	return len(r.Gaps) > 0
+}
+
+func (r SeriesReport) String() string {
+	gaps := []string{}
+	for _, gap := range r.Gaps {
+		gaps = append(gaps, fmt.Sprintf("%s-%s (%s)", gap.From.Time().Format(time.RFC3339),
+			gap.To.Time().Format(time.RFC3339), gap.Duration()))
+	}
+	return fmt.Sprintf("%s: %d samples, median spacing %s, %d gaps [%s], %d duplicates, %d counter resets",
+		r.Metric, r.Samples, r.MedianSpacing, len(r.Gaps), strings.Join(gaps, ", "), len(r.Duplicates), len(r.CounterResets))
+}
+
+// Analyze reports the gaps, duplicates and counter resets of every series of the matrix,
+// the matrix is expected to contain raw samples as returned by QueryRawSamples
+func (a GapAnalysis) Analyze(matrix model.Matrix) []SeriesReport {
+	gapFactor := a.GapFactor
+	if gapFactor <= 0 {
+		gapFactor = 2
+	}
+	maxDistance := time.Duration(float64(a.Interval) * gapFactor)
+	start := model.TimeFromUnixNano(a.Start.UnixNano())
+	end := model.TimeFromUnixNano(a.End.UnixNano())
+
+	reports := []SeriesReport{}
+	for _, stream := range matrix {
+		report := SeriesReport{Metric: stream.Metric, Samples: len(stream.Values)}
+		values := stream.Values
+		if len(values) == 0 {
+			if !a.Start.IsZero() && !a.End.IsZero() {
+				report.Gaps = append(report.Gaps, Gap{From: start, To: end})
+			}
+			reports = append(reports, report)
+			continue
+		}
+
+		if !a.Start.IsZero() {
+			if values[0].Timestamp.Sub(start) > maxDistance {
+				report.Gaps = append(report.Gaps, Gap{From: start, To: values[0].Timestamp})
+			}
+		}
+		distances := []time.Duration{}
+		for i := 1; i < len(values); i++ {
+			prev, cur := values[i-1], values[i]
+			distance := cur.Timestamp.Sub(prev.Timestamp)
+			distances = append(distances, distance)
+			if distance > maxDistance {
+				report.Gaps = append(report.Gaps, Gap{From: prev.Timestamp, To: cur.Timestamp})
+			}
+			if distance < a.Interval/2 {
+				report.Duplicates = append(report.Duplicates, cur.Timestamp)
+			}
+			if cur.Value < prev.Value {
+				report.CounterResets = append(report.CounterResets, cur.Timestamp)
+			}
+		}
+		if len(distances) > 0 {
+			sort.Slice(distances, func(i, j int) bool { return distances[i] < distances[j] })
+			report.MedianSpacing = distances[len(distances)/2]
+		}
+		if !a.End.IsZero() {
+			last := values[len(values)-1].Timestamp
+			if end.Sub(last) > maxDistance {
+				report.Gaps = append(report.Gaps, Gap{From: last, To: end})
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// CheckNoDataLoss checks there are samples for the series selector between start and end,
+// and that no series has a gap longer than twice the collection interval
+func CheckNoDataLoss(opt TestOptions, selector string, start, end time.Time, interval time.Duration) error {
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err
+	}
+	matrix, err := client.QueryRawSamples(selector, start, end)
+	if err != nil {
+		return err
+	}
+	if len(matrix) == 0 {
+		return fmt.Errorf("no data found for %s between %s and %s", selector,
+			start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	lossy := []string{}
+	analysis := GapAnalysis{Interval: interval, Start: start, End: end}
+	for _, report := range analysis.Analyze(matrix) {
+		if report.HasDataLoss() {
+			lossy = append(lossy, report.String())
+		}
+	}
+	if len(lossy) > 0 {
+		return fmt.Errorf("data lost for %s between %s and %s: %s", selector,
+			start.Format(time.RFC3339), end.Format(time.RFC3339), strings.Join(lossy, "; "))
+	}
+	return nil
+}
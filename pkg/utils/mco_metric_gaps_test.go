@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSampleStream(cluster string, start time.Time, offsets []time.Duration, values []float64) *model.SampleStream {
+	stream := &model.SampleStream{
+		Metric: model.Metric{"__name__": "node_memory_MemAvailable_bytes", "cluster": model.LabelValue(cluster)},
+	}
+	for i, offset := range offsets {
+		stream.Values = append(stream.Values, model.SamplePair{
+			Timestamp: model.TimeFromUnixNano(start.Add(offset).UnixNano()),
+			Value:     model.SampleValue(values[i]),
+		})
+	}
+	return stream
+}
+
+func TestGapAnalysis(t *testing.T) {
+	start := time.Unix(1617000000, 0)
+	end := start.Add(5 * time.Minute)
+	matrix := model.Matrix{
+		newSampleStream("healthy", start,
+			[]time.Duration{30 * time.Second, 90 * time.Second, 150 * time.Second, 210 * time.Second, 270 * time.Second},
+			[]float64{1, 2, 3, 4, 5}),
+		newSampleStream("lossy", start,
+			[]time.Duration{30 * time.Second, 60 * time.Second, 65 * time.Second, 240 * time.Second},
+			[]float64{10, 20, 5, 30}),
+	}
+
+	analysis := GapAnalysis{Interval: time.Minute, Start: start, End: end}
+	reports := analysis.Analyze(matrix)
+	require.Len(t, reports, 2)
+
+	assert.False(t, reports[0].HasDataLoss(), reports[0].String())
+	assert.Empty(t, reports[0].Duplicates)
+	assert.Empty(t, reports[0].CounterResets)
+	assert.Equal(t, time.Minute, reports[0].MedianSpacing)
+
+	assert.True(t, reports[1].HasDataLoss())
+	require.Len(t, reports[1].Gaps, 1)
+	assert.Equal(t, 175*time.Second, reports[1].Gaps[0].Duration())
+	assert.Equal(t, 30*time.Second, reports[1].MedianSpacing)
+	assert.Len(t, reports[1].Duplicates, 1, "only the sample 5s after the previous one is below half the interval")
+	assert.Equal(t, []model.Time{model.TimeFromUnixNano(start.Add(65 * time.Second).UnixNano())}, reports[1].CounterResets)
+
+	// a series which stopped reporting has a gap up to the end of the window
+	analysis.End = end.Add(5 * time.Minute)
+	reports = analysis.Analyze(matrix[:1])
+	require.Len(t, reports[0].Gaps, 1)
+	assert.Equal(t, model.TimeFromUnixNano(analysis.End.UnixNano()), reports[0].Gaps[0].To)
+}
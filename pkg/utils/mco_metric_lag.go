@@ -0,0 +1,157 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"k8s.io/klog"
+)
+
+// IngestionLagSelector selects the series the ingestion lag is measured with, they are
+// scraped on every managed cluster
+const IngestionLagSelector = "node_memory_MemAvailable_bytes"
+
+// DefaultIngestionLagSLO allows the lag of a collection interval plus the time to write and query the samples
+var DefaultIngestionLagSLO = IngestionLagSLO{
+	P95: model.Duration(2 * time.Minute),
+	Max: model.Duration(5 * time.Minute),
+}
+
+// LagReport is the ingestion lag measured for one managed cluster
+type LagReport struct {
+	Cluster string
+	Samples int
+	P50     time.Duration
+	P95     time.Duration
+	Max     time.Duration
+}
+
+func (r LagReport) String() string {
+	return fmt.Sprintf("%s: p50 %s, p95 %s, max %s over %d measurements", r.Cluster, r.P50, r.P95, r.Max, r.Samples)
+}
+
+// GetIngestionLagSLO returns the SLO of the options with the unset values defaulted
+func GetIngestionLagSLO(opt TestOptions) IngestionLagSLO {
+	slo := opt.IngestionLagSLO
+	if slo.P95 == 0 {
+		slo.P95 = DefaultIngestionLagSLO.P95
+	}
+	if slo.Max == 0 {
+		slo.Max = DefaultIngestionLagSLO.Max
+	}
+	return slo
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// newLagReport summarizes the lags measured for the cluster
+func newLagReport(cluster string, lags []time.Duration) LagReport {
+	sorted := append([]time.Duration{}, lags...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	report := LagReport{Cluster: cluster, Samples: len(sorted)}
+	if len(sorted) > 0 {
+		report.P50 = percentile(sorted, 50)
+		report.P95 = percentile(sorted, 95)
+		report.Max = sorted[len(sorted)-1]
+	}
+	return report
+}
+
+// MeasureIngestionLag compares the timestamp of the newest sample of the selector of every cluster
+// with the wall clock, every step during the window. The clocks of the hub and the test host are
+// expected to be in sync
+func MeasureIngestionLag(client *PrometheusClient, selector string, window, step time.Duration) ([]LagReport, error) {
+	query, err := BuildQuery(Aggregate("max", Func("timestamp", rawExpr(selector)), "cluster"))
+	if err != nil {
+		return nil, err
+	}
+
+	lags := map[string][]time.Duration{}
+	end := time.Now().Add(window)
+	for {
+		vector, err := client.QueryVector(query)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		for _, sample := range vector {
+			cluster := string(sample.Metric["cluster"])
+			ts := time.Unix(0, int64(float64(sample.Value)*float64(time.Second)))
+			lag := now.Sub(ts)
+			if lag < 0 {
+				lag = 0
+			}
+			lags[cluster] = append(lags[cluster], lag)
+		}
+		if now.Add(step).After(end) {
+			break
+		}
+		time.Sleep(step)
+	}
+
+	reports := []LagReport{}
+	for cluster, clusterLags := range lags {
+		reports = append(reports, newLagReport(cluster, clusterLags))
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Cluster < reports[j].Cluster })
+	return reports, nil
+}
+
+// CheckIngestionLag reports the breaches of the SLO, and the clusters without any sample
+func CheckIngestionLag(reports []LagReport, clusters []string, slo IngestionLagSLO) error {
+	problems := []string{}
+	measured := map[string]bool{}
+	for _, report := range reports {
+		measured[report.Cluster] = true
+		if report.P95 > time.Duration(slo.P95) || report.Max > time.Duration(slo.Max) {
+			problems = append(problems, report.String())
+		}
+	}
+	for _, cluster := range clusters {
+		if !measured[cluster] {
+			problems = append(problems, fmt.Sprintf("%s: no samples", cluster))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("ingestion lag breaches the SLO p95 %s, max %s: %s", slo.P95, slo.Max, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CheckIngestionLagSLO measures the ingestion lag of every managed cluster during the window,
+// and fails if the SLO in the options is breached
+func CheckIngestionLagSLO(opt TestOptions, window time.Duration) error {
+	clusters, err := ListObservabilityEnabledClusters(opt)
+	if err != nil {
+		return err
+	}
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err
+	}
+	reports, err := MeasureIngestionLag(client, IngestionLagSelector, window, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		klog.V(1).Infof("ingestion lag of %s", report)
+	}
+	return CheckIngestionLag(reports, clusters, GetIngestionLagSLO(opt))
+}
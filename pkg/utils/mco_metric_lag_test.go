@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLagReport(t *testing.T) {
+	lags := []time.Duration{}
+	for i := 20; i >= 1; i-- {
+		lags = append(lags, time.Duration(i)*time.Second)
+	}
+	report := newLagReport("cluster1", lags)
+	assert.Equal(t, LagReport{Cluster: "cluster1", Samples: 20, P50: 10 * time.Second, P95: 19 * time.Second, Max: 20 * time.Second}, report)
+
+	slo := IngestionLagSLO{P95: model.Duration(30 * time.Second), Max: model.Duration(time.Minute)}
+	assert.NoError(t, CheckIngestionLag([]LagReport{report}, []string{"cluster1"}, slo))
+
+	err := CheckIngestionLag([]LagReport{report}, []string{"cluster1", "cluster2"}, slo)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cluster2: no samples")
+	}
+	slo.Max = model.Duration(15 * time.Second)
+	assert.Error(t, CheckIngestionLag([]LagReport{report}, []string{"cluster1"}, slo), "max breached")
+}
+
+func TestMeasureIngestionLag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, `max by (cluster) (timestamp(node_memory_MemAvailable_bytes))`, r.URL.Query().Get("query"))
+		now := float64(time.Now().UnixNano()) / 1e9
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"cluster":"cluster1"},"value":[%f,"%f"]},
+			{"metric":{"cluster":"cluster2"},"value":[%f,"%f"]}]}}`, now, now-30, now, now-90)
+	}))
+	defer server.Close()
+
+	reports, err := MeasureIngestionLag(&PrometheusClient{URL: server.URL}, IngestionLagSelector, 0, time.Second)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "cluster1", reports[0].Cluster)
+	assert.InDelta(t, 30, reports[0].Max.Seconds(), 1)
+	assert.InDelta(t, 90, reports[1].P95.Seconds(), 1)
+
+	assert.NoError(t, CheckIngestionLag(reports, []string{"cluster1", "cluster2"}, DefaultIngestionLagSLO))
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeQueryAPI serves canned responses of the Prometheus HTTP API keyed by query
+func newFakeQueryAPI(t *testing.T, responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		resp, ok := responses[r.URL.Query().Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error at char 1"}`)
+			return
+		}
+		fmt.Fprint(w, resp)
+	}))
+}
+
+func TestPrometheusClientQuery(t *testing.T) {
+	server := newFakeQueryAPI(t, map[string]string{
+		`node_memory_MemAvailable_bytes{cluster="local-cluster"}`: `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"node_memory_MemAvailable_bytes","cluster":"local-cluster","instance":"a"},"value":[1617000000.5,"1024"]},
+			{"metric":{"__name__":"node_memory_MemAvailable_bytes","cluster":"local-cluster","instance":"b"},"value":[1617000000.5,"2048"]}]}}`,
+		`up[1m]`: `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","job":"node"},"values":[[1617000000,"1"],[1617000030,"1"]]}]}}`,
+		`scalar(1)`: `{"status":"success","data":{"resultType":"scalar","result":[1617000000,"1"]}}`,
+	})
+	defer server.Close()
+	client := &PrometheusClient{URL: server.URL, Auth: BearerTokenAuth("test-token")}
+
+	vector, err := client.QueryVector(`node_memory_MemAvailable_bytes{cluster="local-cluster"}`)
+	require.NoError(t, err)
+	require.Len(t, vector, 2)
+	assert.Equal(t, model.SampleValue(1024), vector[0].Value)
+	assert.Equal(t, model.TimeFromUnixNano(1617000000500*int64(time.Millisecond)), vector[0].Timestamp)
+	assert.True(t, ContainsSample(vector, HasLabels(map[string]string{"instance": "b"}), ValueGreaterThan(2000)))
+	assert.False(t, ContainsSample(vector, HasLabels(map[string]string{"instance": "a"}), ValueGreaterThan(2000)))
+	assert.Len(t, FilterSamples(vector, HasLabels(map[string]string{"cluster": "local-cluster"})), 2)
+
+	value, err := client.Query(`up[1m]`, time.Now())
+	require.NoError(t, err)
+	matrix, ok := value.(model.Matrix)
+	require.True(t, ok, "expect matrix but got %s", value.Type())
+	require.Len(t, matrix, 1)
+	assert.Len(t, matrix[0].Values, 2)
+
+	value, err = client.Query(`scalar(1)`, time.Time{})
+	require.NoError(t, err)
+	scalar, ok := value.(*model.Scalar)
+	require.True(t, ok, "expect scalar but got %s", value.Type())
+	assert.Equal(t, model.SampleValue(1), scalar.Value)
+
+	_, err = client.QueryVector(`scalar(1)`)
+	assert.Error(t, err, "scalar is not a vector")
+}
+
+func TestPrometheusClientQueryError(t *testing.T) {
+	server := newFakeQueryAPI(t, map[string]string{})
+	defer server.Close()
+	client := &PrometheusClient{URL: server.URL, Auth: BearerTokenAuth("test-token")}
+
+	_, err := client.Query(`node_memory_MemAvailable_bytes{cluster="local-cluster}`, time.Time{})
+	require.Error(t, err)
+	queryErr, ok := err.(*QueryError)
+	require.True(t, ok, "expect QueryError but got %T", err)
+	assert.Equal(t, http.StatusBadRequest, queryErr.StatusCode)
+	assert.Equal(t, "bad_data", queryErr.ErrorType)
+	assert.Equal(t, "parse error at char 1", queryErr.Err)
+}
+
+func TestParseLabelFragments(t *testing.T) {
+	labels, err := parseLabelFragments([]string{`"__name__":"ALERTS"`, `"alertname":"NodeOutOfMemory"`})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"__name__": "ALERTS", "alertname": "NodeOutOfMemory"}, labels)
+
+	_, err = parseLabelFragments([]string{`__name__=ALERTS`})
+	assert.Error(t, err)
+}
@@ -4,8 +4,13 @@
 package utils
 
 import (
+	"fmt"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog"
 )
 
@@ -35,3 +40,67 @@ func DeletePod(opt TestOptions, isHub bool, namespace, name string) error {
 	}
 	return nil
 }
+
+// isPodReady tells whether the pod is running with all its containers ready
+func isPodReady(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForPodReady watches the pods with the label selector until one of them is running with all
+// its containers ready, and returns it
+func WaitForPodReady(opt TestOptions, isHub bool, namespace, labelSelector string, timeout time.Duration) (*v1.Pod, error) {
+	pods := getKubeClient(opt, isHub).CoreV1().Pods(namespace)
+	listOption := metav1.ListOptions{LabelSelector: labelSelector}
+	podList, err := pods.List(listOption)
+	if err != nil {
+		return nil, err
+	}
+	for i := range podList.Items {
+		if isPodReady(&podList.Items[i]) {
+			return &podList.Items[i], nil
+		}
+	}
+
+	timeoutSeconds := int64(timeout.Seconds())
+	listOption.ResourceVersion = podList.ResourceVersion
+	listOption.TimeoutSeconds = &timeoutSeconds
+	watcher, err := pods.Watch(listOption)
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch of the pods with labels %s in namespace %s closed before any pod is ready", labelSelector, namespace)
+			}
+			if event.Type == watch.Error {
+				return nil, apierrors.FromObject(event.Object)
+			}
+			pod, ok := event.Object.(*v1.Pod)
+			if !ok || event.Type == watch.Deleted {
+				continue
+			}
+			klog.V(3).Infof("pod %s is %s", pod.Name, pod.Status.Phase)
+			if isPodReady(pod) {
+				return pod, nil
+			}
+		case <-timer.C:
+			return nil, fmt.Errorf("timed out after %s waiting for a ready pod with labels %s in namespace %s", timeout, labelSelector, namespace)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+const (
+	QueryEndpointGrafana        = "grafana"
+	QueryEndpointQueryFrontend  = "query-frontend"
+	QueryEndpointRBACQueryProxy = "rbac-query-proxy"
+
+	DefaultGrafanaDatasource = "Observatorium"
+)
+
+// ResolveQueryEndpoint returns the query endpoint of the options with the defaults filled in,
+// the THANOS_QUERY_FRONTEND_URL and IS_CANARY_ENV envs are honored if no type is configured
+func ResolveQueryEndpoint(opt TestOptions) QueryEndpoint {
+	endpoint := opt.QueryEndpoint
+	if endpoint.Type == "" {
+		endpoint.Type = QueryEndpointGrafana
+		// TODO(morvencao): remove this after accessing metrics from grafana url with bearer token is supported
+		if os.Getenv("IS_CANARY_ENV") != "true" && os.Getenv("THANOS_QUERY_FRONTEND_URL") != "" {
+			endpoint.Type = QueryEndpointQueryFrontend
+			if endpoint.URL == "" {
+				endpoint.URL = os.Getenv("THANOS_QUERY_FRONTEND_URL")
+			}
+		}
+	}
+
+	switch endpoint.Type {
+	case QueryEndpointGrafana:
+		if endpoint.URL == "" {
+			endpoint.URL = GetGrafanaURL(opt)
+		}
+		if endpoint.Host == "" {
+			endpoint.Host = opt.HubCluster.GrafanaHost
+		}
+		if endpoint.Datasource == "" {
+			endpoint.Datasource = DefaultGrafanaDatasource
+		}
+	case QueryEndpointQueryFrontend:
+		if endpoint.URL == "" {
+			endpoint.URL = "https://observability-thanos-query-frontend-" + MCO_NAMESPACE + ".apps." + opt.HubCluster.BaseDomain
+		}
+	case QueryEndpointRBACQueryProxy:
+		if endpoint.URL == "" {
+			endpoint.URL = "https://rbac-query-proxy-" + MCO_NAMESPACE + ".apps." + opt.HubCluster.BaseDomain
+		}
+	}
+	endpoint.URL = strings.TrimSuffix(endpoint.URL, "/")
+	return endpoint
+}
+
+// NewPrometheusClientForEndpoint returns the client for the given query endpoint:
+// grafana is queried through the datasource proxy with the grafana client of the options, so the
+// queries are authenticated as configured by grafanaAuth and sent through the forwarded port if
+// grafanaPortForward is set, unless a bearer token is configured for the endpoint. The query
+// frontend is queried directly without credentials, and the rbac-query-proxy with a bearer token
+// which decides the clusters the results are restricted to, the token defaults to the token of
+// the testing service account
+func NewPrometheusClientForEndpoint(opt TestOptions, endpoint QueryEndpoint) (*PrometheusClient, error) {
+	client := &PrometheusClient{
+		URL:        endpoint.URL,
+		Host:       endpoint.Host,
+		HTTPClient: newHTTPClient(),
+	}
+
+	switch endpoint.Type {
+	case QueryEndpointQueryFrontend:
+		return client, nil
+	case QueryEndpointGrafana:
+		return newGrafanaPrometheusClient(opt, endpoint)
+	case QueryEndpointRBACQueryProxy:
+		token := endpoint.BearerToken
+		if token == "" {
+			var err error
+			token, err = FetchBearerToken(opt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		client.Auth = BearerTokenAuth(token)
+		return client, nil
+	}
+	return nil, fmt.Errorf("unknown query endpoint type %s", endpoint.Type)
+}
+
+// newGrafanaPrometheusClient returns the client of the datasource of the grafana endpoint. The
+// datasource is looked up in the frontend settings, which unlike /api/datasources are readable
+// by viewers
+func newGrafanaPrometheusClient(opt TestOptions, endpoint QueryEndpoint) (*PrometheusClient, error) {
+	grafana, err := newGrafanaClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	if !opt.HubCluster.GrafanaPortForward {
+		grafana.URL = endpoint.URL
+		grafana.Host = endpoint.Host
+	}
+	if endpoint.BearerToken != "" {
+		grafana.Auth = BearerTokenAuth(endpoint.BearerToken)
+	}
+
+	datasources, err := grafana.FrontendDatasources()
+	if err != nil {
+		return nil, err
+	}
+	for _, datasource := range datasources {
+		if datasource.Name == endpoint.Datasource {
+			klog.V(3).Infof("grafana datasource %s has id %d", datasource.Name, datasource.ID)
+			return grafana.PrometheusClient(datasource), nil
+		}
+	}
+	return nil, fmt.Errorf("grafana datasource %s not found", endpoint.Datasource)
+}
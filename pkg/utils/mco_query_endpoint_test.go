@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setEnv sets the env, or unsets it if the value is empty, and returns the function restoring
+// its previous value
+func setEnv(name, value string) func() {
+	previous, ok := os.LookupEnv(name)
+	if value == "" {
+		os.Unsetenv(name)
+	} else {
+		os.Setenv(name, value)
+	}
+	return func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestResolveQueryEndpoint(t *testing.T) {
+	defer setEnv("IS_CANARY_ENV", "")()
+	defer setEnv("THANOS_QUERY_FRONTEND_URL", "")()
+	opt := TestOptions{HubCluster: Cluster{BaseDomain: "example.com"}}
+
+	endpoint := ResolveQueryEndpoint(opt)
+	assert.Equal(t, QueryEndpointGrafana, endpoint.Type)
+	assert.Equal(t, "https://multicloud-console.apps.example.com/grafana", endpoint.URL)
+	assert.Equal(t, DefaultGrafanaDatasource, endpoint.Datasource)
+
+	os.Setenv("THANOS_QUERY_FRONTEND_URL", "https://query-frontend.example.com/")
+	endpoint = ResolveQueryEndpoint(opt)
+	assert.Equal(t, QueryEndpointQueryFrontend, endpoint.Type)
+	assert.Equal(t, "https://query-frontend.example.com", endpoint.URL)
+
+	opt.QueryEndpoint = QueryEndpoint{Type: QueryEndpointRBACQueryProxy}
+	endpoint = ResolveQueryEndpoint(opt)
+	assert.Equal(t, "https://rbac-query-proxy-open-cluster-management-observability.apps.example.com", endpoint.URL)
+}
+
+func TestNewPrometheusClientForGrafanaEndpoint(t *testing.T) {
+	defer setEnv("IS_CANARY_ENV", "")()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/frontend/settings":
+			fmt.Fprint(w, `{"datasources":{"Observatorium":{"id":3,"type":"prometheus"},"-- Grafana --":{"id":-1}}}`)
+		case "/api/datasources/proxy/3/api/v1/query":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	endpoint := QueryEndpoint{Type: QueryEndpointGrafana, URL: server.URL, Datasource: "Observatorium", BearerToken: "test-token"}
+	client, err := NewPrometheusClientForEndpoint(TestOptions{}, endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/api/datasources/proxy/3", client.URL)
+	_, err = client.QueryVector("up")
+	assert.NoError(t, err)
+
+	endpoint.Datasource = "Missing"
+	_, err = NewPrometheusClientForEndpoint(TestOptions{}, endpoint)
+	assert.Error(t, err)
+}
+
+func TestNewPrometheusClientForGrafanaEndpointWithGrafanaAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		assert.Equal(t, "kube:admin", r.Header.Get(GrafanaForwardedUserHeader))
+		switch r.URL.Path {
+		case "/api/frontend/settings":
+			fmt.Fprint(w, `{"datasources":{"Observatorium":{"id":3,"type":"prometheus"}}}`)
+		case "/api/datasources/proxy/3/api/v1/query":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	opt := TestOptions{GrafanaAuth: GrafanaAuth{Mode: GrafanaAuthForwardedUser, User: "kube:admin"}}
+	endpoint := QueryEndpoint{Type: QueryEndpointGrafana, URL: server.URL, Datasource: "Observatorium"}
+	client, err := NewPrometheusClientForEndpoint(opt, endpoint)
+	require.NoError(t, err)
+	_, err = client.QueryVector("up")
+	assert.NoError(t, err)
+}
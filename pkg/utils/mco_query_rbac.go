@@ -0,0 +1,214 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// queryIdentityRole is bound in the managed cluster namespaces, the rbac-query-proxy allows
+	// an identity to read the metrics of the clusters whose namespace it can view
+	queryIdentityRole = "view"
+	// saTokenTimeout is how long the token controller is given to create the token of a service account
+	saTokenTimeout      = time.Minute
+	saTokenPollInterval = 2 * time.Second
+)
+
+// QueryIdentity is a service account allowed to read the metrics of a subset of the managed clusters
+type QueryIdentity struct {
+	Name      string
+	Namespace string
+	Clusters  []string
+	Token     string
+}
+
+// CreateQueryIdentity creates a service account with the view role in the namespace of each cluster,
+// and waits for its token. The service account and rolebindings already created are deleted on error
+func CreateQueryIdentity(opt TestOptions, name string, clusters []string) (*QueryIdentity, error) {
+	identity := &QueryIdentity{Name: name, Namespace: MCO_NAMESPACE, Clusters: clusters}
+	if err := createQueryIdentity(opt, identity); err != nil {
+		if cleanErr := DeleteQueryIdentity(opt, identity); cleanErr != nil {
+			klog.Errorf("Failed to clean up query identity %s due to %v", name, cleanErr)
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+func createQueryIdentity(opt TestOptions, identity *QueryIdentity) error {
+	name := identity.Name
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: identity.Namespace,
+			Labels: map[string]string{
+				"app": "mco-e2e-testing",
+			},
+		},
+	}
+	if err := CreateSA(opt, true, identity.Namespace, sa); err != nil {
+		return fmt.Errorf("failed to create serviceaccount %s: %v", name, err)
+	}
+
+	for _, cluster := range identity.Clusters {
+		rb := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cluster,
+				Labels: map[string]string{
+					"app": "mco-e2e-testing",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind:     "ClusterRole",
+				Name:     queryIdentityRole,
+				APIGroup: "rbac.authorization.k8s.io",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      name,
+					Namespace: identity.Namespace,
+				},
+			},
+		}
+		if err := CreateRB(opt, true, cluster, rb); err != nil {
+			return fmt.Errorf("failed to create rolebinding for %s in %s: %v", name, cluster, err)
+		}
+	}
+
+	token, err := WaitForSAToken(opt, true, identity.Namespace, name, saTokenTimeout)
+	if err != nil {
+		return err
+	}
+	identity.Token = token
+	return nil
+}
+
+// DeleteQueryIdentity deletes the rolebindings and the service account of the identity
+func DeleteQueryIdentity(opt TestOptions, identity *QueryIdentity) error {
+	for _, cluster := range identity.Clusters {
+		if err := DeleteRB(opt, true, cluster, identity.Name); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	if err := DeleteSA(opt, true, identity.Namespace, identity.Name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// GetSAToken returns the token of the service account, which is created asynchronously
+// by the token controller after the service account
+func GetSAToken(opt TestOptions, isHub bool, namespace, name string) (string, error) {
+	clientKube := getKubeClient(opt, isHub)
+	sa, err := clientKube.CoreV1().ServiceAccounts(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range sa.Secrets {
+		secret, err := clientKube.CoreV1().Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if secret.Type != corev1.SecretTypeServiceAccountToken {
+			continue
+		}
+		if token, ok := secret.Data[corev1.ServiceAccountTokenKey]; ok {
+			return string(token), nil
+		}
+	}
+	return "", fmt.Errorf("failed to find the token of serviceaccount %s/%s", namespace, name)
+}
+
+// WaitForSAToken waits until the token controller has created the token of the service account
+func WaitForSAToken(opt TestOptions, isHub bool, namespace, name string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		token, err := GetSAToken(opt, isHub, namespace, name)
+		if err == nil {
+			return token, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out after %s waiting for the token: %v", timeout, err)
+		}
+		klog.V(3).Infof("waiting for the token of serviceaccount %s/%s: %v", namespace, name, err)
+		time.Sleep(saTokenPollInterval)
+	}
+}
+
+// RBACQueryProxyEndpoint returns the rbac-query-proxy endpoint, using the url of the
+// query endpoint in the options if it is the rbac-query-proxy
+func RBACQueryProxyEndpoint(opt TestOptions) QueryEndpoint {
+	if opt.QueryEndpoint.Type != QueryEndpointRBACQueryProxy {
+		opt.QueryEndpoint = QueryEndpoint{Type: QueryEndpointRBACQueryProxy}
+	}
+	return ResolveQueryEndpoint(opt)
+}
+
+// NewPrometheusClientForIdentity returns the client querying the rbac-query-proxy with the token of the identity
+func NewPrometheusClientForIdentity(opt TestOptions, identity *QueryIdentity) (*PrometheusClient, error) {
+	endpoint := RBACQueryProxyEndpoint(opt)
+	endpoint.BearerToken = identity.Token
+	return NewPrometheusClientForEndpoint(opt, endpoint)
+}
+
+// CheckQueryIsolation runs the query and checks every series has one of the allowed cluster labels,
+// the series of all the allowed clusters are expected unless the identity is allowed no cluster
+func CheckQueryIsolation(client *PrometheusClient, query string, allowed []string) error {
+	vector, err := client.QueryVector(query)
+	if err != nil {
+		return err
+	}
+
+	allowedSet := map[string]bool{}
+	for _, cluster := range allowed {
+		allowedSet[cluster] = true
+	}
+	seen := map[string]bool{}
+	leaked := map[string]bool{}
+	for _, sample := range vector {
+		cluster := string(sample.Metric[model.LabelName("cluster")])
+		if allowedSet[cluster] {
+			seen[cluster] = true
+		} else {
+			leaked[cluster] = true
+		}
+	}
+	if len(leaked) > 0 {
+		return fmt.Errorf("query %s returned series of clusters %v which are not allowed, allowed clusters are %v",
+			query, sortedKeys(leaked), allowed)
+	}
+
+	missing := []string{}
+	for _, cluster := range allowed {
+		if !seen[cluster] {
+			missing = append(missing, cluster)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("query %s returned no series of the allowed clusters %v", query, missing)
+	}
+	klog.V(1).Infof("query %s returned series of the allowed clusters %v only", query, allowed)
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
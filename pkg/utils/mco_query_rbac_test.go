@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRBACQueryProxy stands in for the rbac-query-proxy: it injects a cluster matcher built from
+// the clusters the token is allowed to see into every selector of the query, and evaluates the
+// rewritten selector against the stored series. If inject is false it leaks all the series
+type fakeRBACQueryProxy struct {
+	t        *testing.T
+	tokens   map[string][]string
+	series   []model.Metric
+	inject   bool
+	rewrites []string
+}
+
+func (p *fakeRBACQueryProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clusters, ok := p.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	expr, err := parser.ParseExpr(r.URL.Query().Get("query"))
+	if !assert.NoError(p.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var selector *parser.VectorSelector
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			if p.inject {
+				vs.LabelMatchers = append(vs.LabelMatchers,
+					labels.MustNewMatcher(labels.MatchRegexp, "cluster", strings.Join(clusters, "|")))
+			}
+			selector = vs
+		}
+		return nil
+	})
+	p.rewrites = append(p.rewrites, expr.String())
+
+	vector := model.Vector{}
+	for _, metric := range p.series {
+		matched := true
+		for _, m := range selector.LabelMatchers {
+			if !m.Matches(string(metric[model.LabelName(m.Name)])) {
+				matched = false
+			}
+		}
+		if matched {
+			vector = append(vector, &model.Sample{Metric: metric, Value: 1, Timestamp: 1617000000000})
+		}
+	}
+	result, _ := json.Marshal(vector)
+	data, _ := json.Marshal(map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"resultType": "vector", "result": json.RawMessage(result)},
+	})
+	w.Write(data)
+}
+
+func TestCheckQueryIsolation(t *testing.T) {
+	proxy := &fakeRBACQueryProxy{
+		t:      t,
+		inject: true,
+		tokens: map[string][]string{
+			"token-1":    {"cluster1"},
+			"token-2":    {"cluster1", "cluster2"},
+			"token-none": {},
+		},
+		series: []model.Metric{
+			{"__name__": "node_memory_MemAvailable_bytes", "cluster": "local-cluster"},
+			{"__name__": "node_memory_MemAvailable_bytes", "cluster": "cluster1"},
+			{"__name__": "node_memory_MemAvailable_bytes", "cluster": "cluster2"},
+		},
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	query := MustBuildQuery(Metric("node_memory_MemAvailable_bytes"))
+
+	client := &PrometheusClient{URL: server.URL, Auth: BearerTokenAuth("token-1")}
+	assert.NoError(t, CheckQueryIsolation(client, query, []string{"cluster1"}))
+	assert.Equal(t, `node_memory_MemAvailable_bytes{cluster=~"cluster1"}`, proxy.rewrites[0])
+
+	client.Auth = BearerTokenAuth("token-2")
+	assert.NoError(t, CheckQueryIsolation(client, query, []string{"cluster1", "cluster2"}))
+	assert.Error(t, CheckQueryIsolation(client, query, []string{"cluster1"}), "cluster2 is not expected")
+
+	client.Auth = BearerTokenAuth("token-none")
+	assert.NoError(t, CheckQueryIsolation(client, query, []string{}))
+
+	proxy.inject = false
+	client.Auth = BearerTokenAuth("token-1")
+	err := CheckQueryIsolation(client, query, []string{"cluster1"})
+	if assert.Error(t, err, "the proxy leaks all the clusters") {
+		assert.Contains(t, err.Error(), "[cluster2 local-cluster]")
+	}
+}
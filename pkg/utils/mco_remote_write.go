@@ -0,0 +1,173 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// ManagedClusterCertSecretName is the client certificate the metrics-collector sends the metrics with
+	ManagedClusterCertSecretName = "observability-managed-cluster-certs"
+	// RemoteWriteProbeMetric is the name of the series written by the remote-write probe
+	RemoteWriteProbeMetric = "e2e_remote_write_probe"
+
+	observatoriumAPIWritePath = "/api/metrics/v1/default/api/v1/receive"
+)
+
+// RemoteWriteProbe writes samples straight to the observatorium-api with the Prometheus remote-write protocol
+type RemoteWriteProbe struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// ProbeResult is the outcome of a write-to-read round trip
+type ProbeResult struct {
+	ProbeID   string
+	WrittenAt time.Time
+	ReadAt    time.Time
+}
+
+// Latency is the time between the write request and the first query returning the sample
+func (r ProbeResult) Latency() time.Duration {
+	return r.ReadAt.Sub(r.WrittenAt)
+}
+
+// GetObservatoriumAPIURL returns the route of the observatorium-api on the hub
+func GetObservatoriumAPIURL(opt TestOptions) string {
+	return "https://observatorium-api-" + MCO_NAMESPACE + ".apps." + opt.HubCluster.BaseDomain
+}
+
+// NewRemoteWriteProbe returns a probe authenticated with the managed cluster client certificate,
+// the certificate is read from the addon namespace of the hub or the managed cluster
+func NewRemoteWriteProbe(opt TestOptions, isHub bool) (*RemoteWriteProbe, error) {
+	clientKube := getKubeClient(opt, isHub)
+	secret, err := clientKube.CoreV1().Secrets(MCO_ADDON_NAMESPACE).Get(ManagedClusterCertSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the certificate in secret %s: %v", ManagedClusterCertSecretName, err)
+	}
+
+	client := newHTTPClient()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return &RemoteWriteProbe{
+		URL:        GetObservatoriumAPIURL(opt) + observatoriumAPIWritePath,
+		HTTPClient: client,
+	}, nil
+}
+
+// NewProbeSeries returns a series with a single sample
+func NewProbeSeries(name string, labels map[string]string, value float64, ts time.Time) prompb.TimeSeries {
+	names := make([]string, 0, len(labels))
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	// the labels of a series are sorted by name in the remote-write protocol
+	series := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+	for _, labelName := range names {
+		series.Labels = append(series.Labels, prompb.Label{Name: labelName, Value: labels[labelName]})
+	}
+	series.Samples = []prompb.Sample{{Value: value, Timestamp: ts.UnixNano() / int64(time.Millisecond)}}
+	return series
+}
+
+// Write sends the series as a snappy compressed protobuf remote-write request
+func (p *RemoteWriteProbe) Write(series ...prompb.TimeSeries) error {
+	data, err := (&prompb.WriteRequest{Timeseries: series}).Marshal()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.URL, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	client := p.HTTPClient
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("remote write to %s failed with status code %d: %s", p.URL, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// MeasureWriteToRead writes a sample with a unique probe_id label, then queries it back
+// every interval until it is found or the timeout expires
+func MeasureWriteToRead(probe *RemoteWriteProbe, client *PrometheusClient, cluster string,
+	timeout, interval time.Duration) (*ProbeResult, error) {
+	result := &ProbeResult{ProbeID: strconv.FormatInt(time.Now().UnixNano(), 36)}
+	query, err := BuildQuery(Metric(RemoteWriteProbeMetric).Eq("probe_id", result.ProbeID))
+	if err != nil {
+		return nil, err
+	}
+
+	result.WrittenAt = time.Now()
+	series := NewProbeSeries(RemoteWriteProbeMetric,
+		map[string]string{"cluster": cluster, "probe_id": result.ProbeID}, 1, result.WrittenAt)
+	if err := probe.Write(series); err != nil {
+		return nil, err
+	}
+
+	deadline := result.WrittenAt.Add(timeout)
+	for {
+		vector, err := client.QueryVector(query)
+		if err != nil {
+			klog.V(1).Infof("failed to query the probe sample: %v", err)
+		} else if ContainsSample(vector, HasLabels(map[string]string{"cluster": cluster}), ValueEquals(1)) {
+			result.ReadAt = time.Now()
+			klog.V(1).Infof("probe %s read back after %s", result.ProbeID, result.Latency())
+			return result, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("probe sample %s not found after %s", query, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// RunRemoteWriteProbe writes a probe sample as the managed cluster and measures how long it
+// takes before it can be queried on the hub
+func RunRemoteWriteProbe(opt TestOptions, isHub bool, timeout time.Duration) (*ProbeResult, error) {
+	probe, err := NewRemoteWriteProbe(opt, isHub)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	// the hub is imported as the managed cluster local-cluster
+	cluster := "local-cluster"
+	if !isHub {
+		cluster = GetManagedClusterName(opt)
+	}
+	return MeasureWriteToRead(probe, client, cluster, timeout, 2*time.Second)
+}
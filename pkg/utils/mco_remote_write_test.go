@@ -0,0 +1,137 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReceiver accepts remote-write requests and serves the received samples to instant queries
+// of a single vector selector after the configured delay
+type fakeReceiver struct {
+	t       *testing.T
+	delay   time.Duration
+	mu      sync.Mutex
+	samples []*model.Sample
+	written time.Time
+}
+
+func (f *fakeReceiver) receive(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(f.t, "snappy", r.Header.Get("Content-Encoding"))
+	assert.Equal(f.t, "application/x-protobuf", r.Header.Get("Content-Type"))
+	compressed, err := ioutil.ReadAll(r.Body)
+	if !assert.NoError(f.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if !assert.NoError(f.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &prompb.WriteRequest{}
+	if err := req.Unmarshal(data); !assert.NoError(f.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.written = time.Now()
+	for _, series := range req.Timeseries {
+		metric := model.Metric{}
+		for _, label := range series.Labels {
+			metric[model.LabelName(label.Name)] = model.LabelValue(label.Value)
+		}
+		for _, sample := range series.Samples {
+			f.samples = append(f.samples, &model.Sample{
+				Metric: metric, Value: model.SampleValue(sample.Value), Timestamp: model.Time(sample.Timestamp)})
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeReceiver) query(w http.ResponseWriter, r *http.Request) {
+	matchers, err := parser.ParseMetricSelector(r.URL.Query().Get("query"))
+	if !assert.NoError(f.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vector := model.Vector{}
+	if !f.written.IsZero() && time.Since(f.written) >= f.delay {
+		for _, sample := range f.samples {
+			matched := true
+			for _, m := range matchers {
+				matched = matched && m.Matches(string(sample.Metric[model.LabelName(m.Name)]))
+			}
+			if matched {
+				vector = append(vector, sample)
+			}
+		}
+	}
+	result, _ := json.Marshal(vector)
+	data, _ := json.Marshal(map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"resultType": "vector", "result": json.RawMessage(result)},
+	})
+	w.Write(data)
+}
+
+func TestMeasureWriteToRead(t *testing.T) {
+	receiver := &fakeReceiver{t: t, delay: 50 * time.Millisecond}
+	mux := http.NewServeMux()
+	mux.HandleFunc(observatoriumAPIWritePath, receiver.receive)
+	mux.HandleFunc("/api/v1/query", receiver.query)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	probe := &RemoteWriteProbe{URL: server.URL + observatoriumAPIWritePath}
+	client := &PrometheusClient{URL: server.URL}
+	result, err := MeasureWriteToRead(probe, client, "cluster1", time.Second, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, result.Latency() >= receiver.delay, "latency %s", result.Latency())
+
+	require.Len(t, receiver.samples, 1)
+	sample := receiver.samples[0]
+	assert.Equal(t, model.Metric{
+		"__name__": RemoteWriteProbeMetric,
+		"cluster":  "cluster1",
+		"probe_id": model.LabelValue(result.ProbeID),
+	}, sample.Metric)
+	assert.Equal(t, model.TimeFromUnixNano(result.WrittenAt.UnixNano()), sample.Timestamp)
+
+	receiver.delay = time.Hour
+	_, err = MeasureWriteToRead(probe, client, "cluster1", 50*time.Millisecond, 10*time.Millisecond)
+	assert.Error(t, err, "the sample is never readable")
+}
+
+func TestRemoteWriteProbeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("tenant not allowed"))
+	}))
+	defer server.Close()
+
+	probe := &RemoteWriteProbe{URL: server.URL}
+	err := probe.Write(NewProbeSeries("up", map[string]string{"cluster": "cluster1"}, 1, time.Now()))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "403: tenant not allowed")
+	}
+}
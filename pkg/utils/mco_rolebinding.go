@@ -0,0 +1,46 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+func DeleteRB(opt TestOptions, isHub bool, namespace string, name string) error {
+	clientKube := getKubeClient(opt, isHub)
+	err := clientKube.RbacV1().RoleBindings(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil {
+		klog.Errorf("Failed to delete rolebinding %s in namespace %s due to %v", name, namespace, err)
+	}
+	return err
+}
+
+func UpdateRB(opt TestOptions, isHub bool, namespace string,
+	rb *rbacv1.RoleBinding) (error, *rbacv1.RoleBinding) {
+	clientKube := getKubeClient(opt, isHub)
+	updateRB, err := clientKube.RbacV1().RoleBindings(namespace).Update(rb)
+	if err != nil {
+		klog.Errorf("Failed to update rolebinding %s due to %v", rb.GetName(), err)
+	}
+	return err, updateRB
+}
+
+func CreateRB(opt TestOptions, isHub bool, namespace string,
+	rb *rbacv1.RoleBinding) error {
+	clientKube := getKubeClient(opt, isHub)
+	_, err := clientKube.RbacV1().RoleBindings(namespace).Create(rb)
+	if err != nil {
+		if errors.IsAlreadyExists(err) {
+			klog.V(1).Infof("rolebinding %s already exists, updating...", rb.GetName())
+			err, _ := UpdateRB(opt, isHub, namespace, rb)
+			return err
+		}
+		klog.Errorf("Failed to create rolebinding %s due to %v", rb.GetName(), err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	appv1 "k8s.io/api/apps/v1"
+	"k8s.io/klog"
+)
+
+const (
+	KindStatefulSet = "StatefulSet"
+	KindDeployment  = "Deployment"
+	// deploymentRevisionAnnotation is the revision of the replicaset a deployment rolls out
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	rolloutPollInterval          = 5 * time.Second
+)
+
+// Rollout follows the rollout of a statefulset or a deployment from the generation and the
+// revision captured when it is created
+type Rollout struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	Generation int64
+	Revision   string
+
+	opt   TestOptions
+	isHub bool
+}
+
+// rolloutStatus is the state of the workload a rollout is checked against
+type rolloutStatus struct {
+	generation         int64
+	observedGeneration int64
+	revision           string
+	// complete tells whether every replica runs the revision and is ready
+	complete bool
+	progress string
+}
+
+func statefulSetRolloutStatus(sts *appv1.StatefulSet) rolloutStatus {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	status := sts.Status
+	return rolloutStatus{
+		generation:         sts.Generation,
+		observedGeneration: status.ObservedGeneration,
+		revision:           status.UpdateRevision,
+		complete: status.ObservedGeneration >= sts.Generation &&
+			status.UpdateRevision == status.CurrentRevision &&
+			status.UpdatedReplicas == replicas &&
+			status.ReadyReplicas == replicas,
+		progress: fmt.Sprintf("%d/%d replicas updated, %d/%d ready, revision %s updated to %s",
+			status.UpdatedReplicas, replicas, status.ReadyReplicas, replicas, status.CurrentRevision, status.UpdateRevision),
+	}
+}
+
+func deploymentRolloutStatus(dep *appv1.Deployment) rolloutStatus {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	status := dep.Status
+	return rolloutStatus{
+		generation:         dep.Generation,
+		observedGeneration: status.ObservedGeneration,
+		revision:           dep.Annotations[deploymentRevisionAnnotation],
+		// the old replicas are counted in status.replicas until they are terminated
+		complete: status.ObservedGeneration >= dep.Generation &&
+			status.UpdatedReplicas == replicas &&
+			status.ReadyReplicas == replicas &&
+			status.AvailableReplicas == replicas &&
+			status.Replicas == replicas,
+		progress: fmt.Sprintf("%d/%d replicas updated, %d/%d ready, %d/%d available, %d old replicas",
+			status.UpdatedReplicas, replicas, status.ReadyReplicas, replicas, status.AvailableReplicas, replicas,
+			status.Replicas-status.UpdatedReplicas),
+	}
+}
+
+func (r *Rollout) String() string {
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+func (r *Rollout) status() (rolloutStatus, error) {
+	switch r.Kind {
+	case KindStatefulSet:
+		err, sts := GetStatefulSet(r.opt, r.isHub, r.Name, r.Namespace)
+		if err != nil {
+			return rolloutStatus{}, err
+		}
+		return statefulSetRolloutStatus(sts), nil
+	case KindDeployment:
+		err, dep := GetDeployment(r.opt, r.isHub, r.Name, r.Namespace)
+		if err != nil {
+			return rolloutStatus{}, err
+		}
+		return deploymentRolloutStatus(dep), nil
+	}
+	return rolloutStatus{}, fmt.Errorf("unsupported kind %s, expected %s or %s", r.Kind, KindStatefulSet, KindDeployment)
+}
+
+// NewRollout captures the current generation and revision of the statefulset or deployment,
+// it is meant to be created before the change which rolls the workload out is applied
+func NewRollout(opt TestOptions, isHub bool, kind, namespace, name string) (*Rollout, error) {
+	r := &Rollout{Kind: kind, Namespace: namespace, Name: name, opt: opt, isHub: isHub}
+	status, err := r.status()
+	if err != nil {
+		return nil, err
+	}
+	r.Generation = status.generation
+	r.Revision = status.revision
+	return r, nil
+}
+
+// checkRollout returns nil if the workload is completely rolled out, and if a change is expected
+// it must have a newer generation or revision than the captured ones
+func (r *Rollout) checkRollout(status rolloutStatus, expectChange bool) error {
+	if expectChange && status.generation == r.Generation && status.revision == r.Revision {
+		return fmt.Errorf("%s is not changed yet: generation %d, revision %s", r, r.Generation, r.Revision)
+	}
+	if status.observedGeneration < status.generation {
+		return fmt.Errorf("%s generation %d is not observed yet, observed generation %d", r, status.generation, status.observedGeneration)
+	}
+	if !status.complete {
+		return fmt.Errorf("%s is rolling out: %s", r, status.progress)
+	}
+	return nil
+}
+
+// Progress returns nil if the rollout is complete, otherwise an error describing its progress.
+// It can be polled with Eventually
+func (r *Rollout) Progress(expectChange bool) error {
+	status, err := r.status()
+	if err != nil {
+		return err
+	}
+	return r.checkRollout(status, expectChange)
+}
+
+// Wait waits until the rollout is complete, and fails with the last progress if it is not
+// complete within the timeout
+func (r *Rollout) Wait(expectChange bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := r.Progress(expectChange)
+		if err == nil {
+			klog.V(1).Infof("%s is rolled out", r)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for the rollout: %v", timeout, err)
+		}
+		klog.V(3).Infof("waiting for the rollout: %v", err)
+		time.Sleep(rolloutPollInterval)
+	}
+}
+
+// WaitForRollout waits until the current generation of the statefulset or deployment of the hub
+// is completely rolled out
+func WaitForRollout(opt TestOptions, kind, namespace, name string, timeout time.Duration) error {
+	r, err := NewRollout(opt, true, kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	return r.Wait(false, timeout)
+}
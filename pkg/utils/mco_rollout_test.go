@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestStatefulSet(generation int64, status appv1.StatefulSetStatus) *appv1.StatefulSet {
+	replicas := int32(3)
+	return &appv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "observability-thanos-rule", Generation: generation},
+		Spec:       appv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     status,
+	}
+}
+
+func TestStatefulSetRollout(t *testing.T) {
+	rollout := &Rollout{Kind: KindStatefulSet, Namespace: MCO_NAMESPACE, Name: "observability-thanos-rule", Generation: 2, Revision: "rev-a"}
+	done := appv1.StatefulSetStatus{ObservedGeneration: 2, CurrentRevision: "rev-a", UpdateRevision: "rev-a", UpdatedReplicas: 3, ReadyReplicas: 3}
+
+	assert.NoError(t, rollout.checkRollout(statefulSetRolloutStatus(newTestStatefulSet(2, done)), false))
+	assert.EqualError(t, rollout.checkRollout(statefulSetRolloutStatus(newTestStatefulSet(2, done)), true),
+		"StatefulSet open-cluster-management-observability/observability-thanos-rule is not changed yet: generation 2, revision rev-a")
+
+	assert.EqualError(t, rollout.checkRollout(statefulSetRolloutStatus(newTestStatefulSet(3, done)), true),
+		"StatefulSet open-cluster-management-observability/observability-thanos-rule generation 3 is not observed yet, observed generation 2")
+
+	rolling := appv1.StatefulSetStatus{ObservedGeneration: 3, CurrentRevision: "rev-a", UpdateRevision: "rev-b", UpdatedReplicas: 1, ReadyReplicas: 2}
+	assert.EqualError(t, rollout.checkRollout(statefulSetRolloutStatus(newTestStatefulSet(3, rolling)), true),
+		"StatefulSet open-cluster-management-observability/observability-thanos-rule is rolling out: 1/3 replicas updated, 2/3 ready, revision rev-a updated to rev-b")
+
+	rolled := appv1.StatefulSetStatus{ObservedGeneration: 3, CurrentRevision: "rev-b", UpdateRevision: "rev-b", UpdatedReplicas: 3, ReadyReplicas: 3}
+	assert.NoError(t, rollout.checkRollout(statefulSetRolloutStatus(newTestStatefulSet(3, rolled)), true))
+}
+
+func TestDeploymentRollout(t *testing.T) {
+	replicas := int32(2)
+	dep := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "observability-thanos-query",
+			Generation:  5,
+			Annotations: map[string]string{deploymentRevisionAnnotation: "4"},
+		},
+		Spec:   appv1.DeploymentSpec{Replicas: &replicas},
+		Status: appv1.DeploymentStatus{ObservedGeneration: 5, Replicas: 3, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2},
+	}
+	rollout := &Rollout{Kind: KindDeployment, Namespace: MCO_NAMESPACE, Name: dep.Name, Generation: 4, Revision: "3"}
+
+	assert.EqualError(t, rollout.checkRollout(deploymentRolloutStatus(dep), true),
+		"Deployment open-cluster-management-observability/observability-thanos-query is rolling out: 2/2 replicas updated, 2/2 ready, 2/2 available, 1 old replicas")
+	dep.Status.Replicas = 2
+	assert.NoError(t, rollout.checkRollout(deploymentRolloutStatus(dep), true))
+
+	_, err := (&Rollout{Kind: "DaemonSet"}).status()
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+const (
+	ThanosRuleDefaultRulesConfigMapName = "thanos-ruler-default-rules"
+	ThanosRuleCustomRulesConfigMapName  = "thanos-ruler-custom-rules"
+	// ThanosRuleHTTPPort is the port of the thanos ruler HTTP API
+	ThanosRuleHTTPPort = 10902
+)
+
+// RuleGroupStatus is a rule group as reported by the /api/v1/rules endpoint
+type RuleGroupStatus struct {
+	Name           string       `json:"name"`
+	File           string       `json:"file"`
+	Rules          []RuleStatus `json:"rules"`
+	Interval       float64      `json:"interval"`
+	EvaluationTime float64      `json:"evaluationTime"`
+}
+
+// RuleStatus is the evaluation status of a recording or alerting rule, the duration and the
+// active alerts are only reported for the alerting rules
+type RuleStatus struct {
+	Name           string      `json:"name"`
+	Query          string      `json:"query"`
+	Type           string      `json:"type"`
+	Health         string      `json:"health"`
+	LastError      string      `json:"lastError,omitempty"`
+	EvaluationTime float64     `json:"evaluationTime"`
+	LastEvaluation time.Time   `json:"lastEvaluation"`
+	Duration       float64     `json:"duration,omitempty"`
+	Alerts         []RuleAlert `json:"alerts,omitempty"`
+}
+
+// RuleAlert is an alert of an alerting rule which is pending or firing
+type RuleAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	State       string            `json:"state"`
+	ActiveAt    *time.Time        `json:"activeAt,omitempty"`
+	Value       string            `json:"value"`
+}
+
+type rulesData struct {
+	Groups []RuleGroupStatus `json:"groups"`
+}
+
+// Rules returns the rule groups and the evaluation status of their rules
+func (c *PrometheusClient) Rules() ([]RuleGroupStatus, error) {
+	data := &rulesData{}
+	if err := c.get("/api/v1/rules", url.Values{}, data); err != nil {
+		return nil, err
+	}
+	return data.Groups, nil
+}
+
+// ParseRuleGroups parses the rule groups of every key of a rules configmap
+func ParseRuleGroups(data map[string]string) ([]rulefmt.RuleGroup, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	groups := []rulefmt.RuleGroup{}
+	for _, key := range keys {
+		parsed, errs := rulefmt.Parse([]byte(data[key]))
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("failed to parse rules %s: %v", key, utilerrors.NewAggregate(errs))
+		}
+		groups = append(groups, parsed.Groups...)
+	}
+	return groups, nil
+}
+
+// GetThanosRuleGroups returns the rule groups of the default rules and the custom rules if they exist
+func GetThanosRuleGroups(opt TestOptions) ([]rulefmt.RuleGroup, error) {
+	groups := []rulefmt.RuleGroup{}
+	for _, name := range []string{ThanosRuleDefaultRulesConfigMapName, ThanosRuleCustomRulesConfigMapName} {
+		err, cm := GetConfigMap(opt, true, name, MCO_NAMESPACE)
+		if err != nil {
+			if errors.IsNotFound(err) && name == ThanosRuleCustomRulesConfigMapName {
+				continue
+			}
+			return nil, err
+		}
+		parsed, err := ParseRuleGroups(cm.Data)
+		if err != nil {
+			return nil, fmt.Errorf("configmap %s: %v", name, err)
+		}
+		groups = append(groups, parsed...)
+	}
+	return groups, nil
+}
+
+// ruleName returns the name of the recording or alerting rule
+func ruleName(rule rulefmt.RuleNode) string {
+	if rule.Record.Value != "" {
+		return rule.Record.Value
+	}
+	return rule.Alert.Value
+}
+
+// CheckRuleEvaluation compares the configured rule groups with the status reported by the ruler,
+// every rule should be loaded, healthy and evaluated within the interval of its group.
+// The problems are reported by group and rule name
+func CheckRuleEvaluation(groups []rulefmt.RuleGroup, statuses []RuleGroupStatus) []error {
+	byGroup := map[string]RuleGroupStatus{}
+	for _, status := range statuses {
+		byGroup[status.Name] = status
+	}
+
+	errs := []error{}
+	for _, group := range groups {
+		status, ok := byGroup[group.Name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("group %s: not loaded by the ruler", group.Name))
+			continue
+		}
+		interval := time.Duration(status.Interval * float64(time.Second))
+		byRule := map[string][]RuleStatus{}
+		for _, rule := range status.Rules {
+			byRule[rule.Name] = append(byRule[rule.Name], rule)
+		}
+
+		for _, rule := range group.Rules {
+			name := ruleName(rule)
+			loaded := byRule[name]
+			if len(loaded) == 0 {
+				errs = append(errs, fmt.Errorf("group %s rule %s: not loaded by the ruler", group.Name, name))
+				continue
+			}
+			// rules can share a name, so the status is consumed in order of definition
+			ruleStatus := loaded[0]
+			byRule[name] = loaded[1:]
+
+			switch {
+			case ruleStatus.Health != "ok":
+				errs = append(errs, fmt.Errorf("group %s rule %s: health is %q, last error: %s",
+					group.Name, name, ruleStatus.Health, ruleStatus.LastError))
+			case ruleStatus.LastError != "":
+				errs = append(errs, fmt.Errorf("group %s rule %s: last error: %s", group.Name, name, ruleStatus.LastError))
+			case interval > 0 && ruleStatus.EvaluationTime > interval.Seconds():
+				errs = append(errs, fmt.Errorf("group %s rule %s: evaluation takes %.3fs, longer than the interval %s",
+					group.Name, name, ruleStatus.EvaluationTime, interval))
+			}
+		}
+	}
+	return errs
+}
+
+// CheckThanosRules checks the default and custom rules are evaluated successfully by the thanos ruler,
+// and that the output series of each recording rule exists in the query layer
+func CheckThanosRules(opt TestOptions) error {
+	groups, err := GetThanosRuleGroups(opt)
+	if err != nil {
+		return err
+	}
+
+	pod := MCO_CR_NAME + "-thanos-rule-0"
+	port, stop, err := PortForward(opt, true, MCO_NAMESPACE, pod, ThanosRuleHTTPPort)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	ruler := &PrometheusClient{URL: fmt.Sprintf("http://127.0.0.1:%d", port)}
+	statuses, err := ruler.Rules()
+	if err != nil {
+		return fmt.Errorf("failed to get rules from %s: %v", pod, err)
+	}
+
+	errs := CheckRuleEvaluation(groups, statuses)
+
+	client, err := NewPrometheusClient(opt)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for _, rule := range group.Rules {
+			if rule.Record.Value == "" {
+				continue
+			}
+			query, err := BuildQuery(Func("count", Metric(rule.Record.Value)))
+			if err != nil {
+				return err
+			}
+			vector, err := client.QueryVector(query)
+			if err != nil {
+				return err
+			}
+			if len(vector) == 0 {
+				errs = append(errs, fmt.Errorf("group %s rule %s: no series recorded", group.Name, rule.Record.Value))
+			}
+		}
+	}
+
+	klog.V(1).Infof("%d rule groups checked, %d problems found", len(groups), len(errs))
+	return utilerrors.NewAggregate(errs)
+}
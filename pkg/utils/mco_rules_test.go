@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+groups:
+  - name: cluster-health
+    rules:
+      - record: cluster:cpu_usage_cores:sum
+        expr: sum(rate(container_cpu_usage_seconds_total[5m])) by (cluster)
+      - record: cluster:memory_usage_bytes:sum
+        expr: sum(container_memory_working_set_bytes) by (cluster)
+      - alert: ClusterCPUHigh
+        expr: cluster:cpu_usage_cores:sum > 100
+        for: 10m
+  - name: missing-group
+    rules:
+      - record: cluster:up:count
+        expr: count(up) by (cluster)
+`
+
+func TestParseRuleGroups(t *testing.T) {
+	groups, err := ParseRuleGroups(map[string]string{"default_rules.yaml": testRules})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Len(t, groups[0].Rules, 3)
+	assert.Equal(t, "ClusterCPUHigh", ruleName(groups[0].Rules[2]))
+
+	_, err = ParseRuleGroups(map[string]string{"custom_rules.yaml": `
+groups:
+  - name: invalid
+    rules:
+      - record: invalid
+        expr: sum(up`})
+	assert.Error(t, err)
+}
+
+func TestCheckRuleEvaluation(t *testing.T) {
+	groups, err := ParseRuleGroups(map[string]string{"default_rules.yaml": testRules})
+	require.NoError(t, err)
+
+	statuses := []RuleGroupStatus{
+		{
+			Name:     "cluster-health",
+			Interval: 30,
+			Rules: []RuleStatus{
+				{Name: "cluster:cpu_usage_cores:sum", Health: "ok", EvaluationTime: 0.01},
+				{Name: "cluster:memory_usage_bytes:sum", Health: "ok", EvaluationTime: 45},
+				{Name: "ClusterCPUHigh", Health: "err", LastError: "vector contains metrics with the same labelset"},
+			},
+		},
+	}
+
+	errs := CheckRuleEvaluation(groups, statuses)
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Error(), "group cluster-health rule cluster:memory_usage_bytes:sum: evaluation takes 45.000s")
+	assert.Contains(t, errs[1].Error(), "group cluster-health rule ClusterCPUHigh: health is \"err\"")
+	assert.Equal(t, "group missing-group: not loaded by the ruler", errs[2].Error())
+}
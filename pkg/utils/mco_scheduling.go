@@ -0,0 +1,212 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+// SchedulingExpectations describes where the MCO and Observatorium pods are expected to be scheduled
+type SchedulingExpectations struct {
+	NodeSelector    map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations     []corev1.Toleration `json:"tolerations,omitempty"`
+	PodAntiAffinity []WeightedTopology  `json:"podAntiAffinity,omitempty"`
+	IgnorePods      []string            `json:"ignorePods,omitempty"`
+}
+
+// WeightedTopology is a preferred pod anti-affinity term identified by its topology key
+type WeightedTopology struct {
+	TopologyKey string `json:"topologyKey"`
+	Weight      int32  `json:"weight"`
+}
+
+// DefaultPodAntiAffinity is the anti-affinity policy the operator applies to all components
+var DefaultPodAntiAffinity = []WeightedTopology{
+	{TopologyKey: "kubernetes.io/hostname", Weight: 30},
+	{TopologyKey: "topology.kubernetes.io/zone", Weight: 70},
+}
+
+// defaultIgnorePods lists the pods the scheduling expectations cannot be applied to.
+// shard-1-0 and shard-2-0 won't be deleted when switch from High to Basic,
+// and cannot apply the nodeSelector to shard-1-0 and shard-2-0
+// https://github.com/open-cluster-management/backlog/issues/6532
+var defaultIgnorePods = []string{
+	MCO_CR_NAME + "-thanos-store-shard-1-0",
+	MCO_CR_NAME + "-thanos-store-shard-2-0",
+}
+
+// LoadSchedulingExpectations reads the scheduling expectations from a yaml file
+func LoadSchedulingExpectations(path string) (*SchedulingExpectations, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expectations := &SchedulingExpectations{}
+	if err := yaml.Unmarshal(data, expectations); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduling expectations %s: %v", path, err)
+	}
+	if len(expectations.PodAntiAffinity) == 0 {
+		expectations.PodAntiAffinity = DefaultPodAntiAffinity
+	}
+	return expectations, nil
+}
+
+// GetSchedulingExpectationsFromMCO builds the scheduling expectations from the nodeSelector
+// and tolerations of the MCO spec
+func GetSchedulingExpectationsFromMCO(opt TestOptions) (*SchedulingExpectations, error) {
+	clientDynamic := NewKubeClientDynamic(
+		opt.HubCluster.MasterURL,
+		opt.KubeConfig,
+		opt.HubCluster.KubeContext)
+	mco, err := clientDynamic.Resource(NewMCOGVRV1BETA2()).Get(MCO_CR_NAME, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	spec, ok := mco.Object["spec"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to find spec in MCO %s", MCO_CR_NAME)
+	}
+	// the nodeSelector and tolerations share the json schema of the pod spec,
+	// so round trip them through json to get the typed values
+	specJSON, err := json.Marshal(map[string]interface{}{
+		"nodeSelector": spec["nodeSelector"],
+		"tolerations":  spec["tolerations"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	expectations := &SchedulingExpectations{}
+	if err := json.Unmarshal(specJSON, expectations); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduling settings of MCO %s: %v", MCO_CR_NAME, err)
+	}
+	expectations.PodAntiAffinity = DefaultPodAntiAffinity
+	return expectations, nil
+}
+
+// GetSchedulingExpectations returns the expectations from the file configured in the
+// test options, and falls back to the MCO spec when no file is configured
+func GetSchedulingExpectations(opt TestOptions) (*SchedulingExpectations, error) {
+	if opt.SchedulingExpectations != "" {
+		return LoadSchedulingExpectations(opt.SchedulingExpectations)
+	}
+	return GetSchedulingExpectationsFromMCO(opt)
+}
+
+// CheckPodScheduling checks the nodeSelector, tolerations and pod anti-affinity of all MCO
+// and Observatorium pods, and reports every violation in a single error
+func CheckPodScheduling(opt TestOptions, expectations *SchedulingExpectations) error {
+	podList, err := GetAllMCOPods(opt)
+	if err != nil {
+		return err
+	}
+
+	ignorePods := map[string]bool{}
+	for _, name := range defaultIgnorePods {
+		ignorePods[name] = true
+	}
+	for _, name := range expectations.IgnorePods {
+		ignorePods[name] = true
+	}
+
+	errs := []error{}
+	for i := range podList {
+		if ignorePods[podList[i].GetName()] {
+			continue
+		}
+		errs = append(errs, checkPodScheduling(&podList[i], expectations)...)
+	}
+	if len(errs) > 0 {
+		klog.V(1).Infof("Found %d scheduling violations", len(errs))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func checkPodScheduling(pod *corev1.Pod, expectations *SchedulingExpectations) []error {
+	errs := []error{}
+
+	for key, value := range expectations.NodeSelector {
+		podValue, ok := pod.Spec.NodeSelector[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("pod %s: nodeSelector %s is missing", pod.GetName(), key))
+		} else if podValue != value {
+			errs = append(errs, fmt.Errorf("pod %s: nodeSelector %s should be %s but got %s",
+				pod.GetName(), key, value, podValue))
+		}
+	}
+
+	for i := range expectations.Tolerations {
+		toleration := &expectations.Tolerations[i]
+		found := false
+		for j := range pod.Spec.Tolerations {
+			if matchToleration(&pod.Spec.Tolerations[j], toleration) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("pod %s: toleration %s is missing", pod.GetName(), formatToleration(toleration)))
+		}
+	}
+
+	if len(expectations.PodAntiAffinity) == 0 {
+		return errs
+	}
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAntiAffinity == nil {
+		return append(errs, fmt.Errorf("pod %s: podAntiAffinity is missing", pod.GetName()))
+	}
+
+	expectedWeights := map[string]int32{}
+	for _, term := range expectations.PodAntiAffinity {
+		expectedWeights[term.TopologyKey] = term.Weight
+	}
+	seen := map[string]bool{}
+	for _, term := range pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		topologyKey := term.PodAffinityTerm.TopologyKey
+		seen[topologyKey] = true
+		weight, ok := expectedWeights[topologyKey]
+		if !ok {
+			errs = append(errs, fmt.Errorf("pod %s: unexpected podAntiAffinity term with topologyKey %s",
+				pod.GetName(), topologyKey))
+		} else if weight != term.Weight {
+			errs = append(errs, fmt.Errorf("pod %s: podAntiAffinity weight for %s should be %d but got %d",
+				pod.GetName(), topologyKey, weight, term.Weight))
+		}
+	}
+	for _, term := range expectations.PodAntiAffinity {
+		if !seen[term.TopologyKey] {
+			errs = append(errs, fmt.Errorf("pod %s: podAntiAffinity term with topologyKey %s is missing",
+				pod.GetName(), term.TopologyKey))
+		}
+	}
+	return errs
+}
+
+// matchToleration is like Toleration.MatchToleration, but treats an empty operator as Equal
+func matchToleration(t, expected *corev1.Toleration) bool {
+	return t.Key == expected.Key &&
+		t.Effect == expected.Effect &&
+		tolerationOperator(t) == tolerationOperator(expected) &&
+		t.Value == expected.Value
+}
+
+func tolerationOperator(t *corev1.Toleration) corev1.TolerationOperator {
+	if t.Operator == "" {
+		return corev1.TolerationOpEqual
+	}
+	return t.Operator
+}
+
+func formatToleration(t *corev1.Toleration) string {
+	return fmt.Sprintf("{key: %s, operator: %s, value: %s, effect: %s}",
+		t.Key, tolerationOperator(t), t.Value, t.Effect)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newScheduledPod(nodeSelector map[string]string, tolerations []corev1.Toleration, terms []WeightedTopology) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "observability-grafana-0"},
+		Spec: corev1.PodSpec{
+			NodeSelector: nodeSelector,
+			Tolerations:  tolerations,
+		},
+	}
+	if terms != nil {
+		antiAffinity := &corev1.PodAntiAffinity{}
+		for _, term := range terms {
+			antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{
+					Weight:          term.Weight,
+					PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: term.TopologyKey},
+				})
+		}
+		pod.Spec.Affinity = &corev1.Affinity{PodAntiAffinity: antiAffinity}
+	}
+	return pod
+}
+
+func TestCheckPodScheduling(t *testing.T) {
+	expectations := &SchedulingExpectations{
+		NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+		Tolerations: []corev1.Toleration{
+			{Key: "node-role.kubernetes.io/infra", Effect: corev1.TaintEffectNoSchedule},
+		},
+		PodAntiAffinity: DefaultPodAntiAffinity,
+	}
+
+	pod := newScheduledPod(
+		map[string]string{"kubernetes.io/os": "linux"},
+		[]corev1.Toleration{
+			{Key: "node.kubernetes.io/not-ready", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+			{Key: "node-role.kubernetes.io/infra", Operator: corev1.TolerationOpEqual, Effect: corev1.TaintEffectNoSchedule},
+		},
+		DefaultPodAntiAffinity)
+	assert.Empty(t, checkPodScheduling(pod, expectations), "conforming pod")
+
+	pod = newScheduledPod(
+		map[string]string{"kubernetes.io/os": "windows"},
+		nil,
+		[]WeightedTopology{{TopologyKey: "kubernetes.io/hostname", Weight: 50}})
+	errs := checkPodScheduling(pod, expectations)
+	assert.Len(t, errs, 4, "nodeSelector, toleration, weight and missing zone term should all be reported")
+
+	pod = newScheduledPod(map[string]string{"kubernetes.io/os": "linux"}, expectations.Tolerations, nil)
+	errs = checkPodScheduling(pod, expectations)
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Error(), "podAntiAffinity is missing")
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/common/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	SyntheticExporterName      = "observability-e2e-exporter"
+	SyntheticExporterNamespace = "observability-e2e-exporter"
+	syntheticExporterPort      = 8080
+)
+
+// SyntheticExporterImage serves the metrics file with the busybox httpd, the tag is pinned so that
+// the runs do not depend on the latest busybox
+var SyntheticExporterImage = "docker.io/library/busybox:1.33.1"
+
+// SyntheticPipelineLabels are the labels the scrape of the service monitor and the hub storage may
+// add to the synthetic series, any other label than the scripted ones, cluster and clusterID fails
+// CheckSyntheticMetrics
+var SyntheticPipelineLabels = []string{
+	"job", "instance", "namespace", "pod", "service", "endpoint", "container",
+	"prometheus", "prometheus_replica", "receive", "tenant_id",
+}
+
+// SyntheticMetric is a series exposed by the synthetic exporter with a known value
+type SyntheticMetric struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+func NewServiceMonitorGVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    "monitoring.coreos.com",
+		Version:  "v1",
+		Resource: "servicemonitors"}
+}
+
+// RenderSyntheticMetrics renders the metrics in the Prometheus text exposition format
+func RenderSyntheticMetrics(metrics []SyntheticMetric) string {
+	byName := map[string][]SyntheticMetric{}
+	names := []string{}
+	for _, metric := range metrics {
+		if _, ok := byName[metric.Name]; !ok {
+			names = append(names, metric.Name)
+		}
+		byName[metric.Name] = append(byName[metric.Name], metric)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, metric := range byName[name] {
+			labelNames := make([]string, 0, len(metric.Labels))
+			for labelName := range metric.Labels {
+				labelNames = append(labelNames, labelName)
+			}
+			sort.Strings(labelNames)
+			pairs := []string{}
+			for _, labelName := range labelNames {
+				pairs = append(pairs, labelName+"="+strconv.Quote(metric.Labels[labelName]))
+			}
+			b.WriteString(name)
+			if len(pairs) > 0 {
+				b.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			b.WriteString(" " + strconv.FormatFloat(metric.Value, 'g', -1, 64) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// syntheticExporterYaml returns the exporter workload: a configmap holding the metrics file served
+// by httpd, and a servicemonitor picked up by the cluster monitoring Prometheus which is federated
+// by the metrics-collector
+func syntheticExporterYaml(metrics []SyntheticMetric) ([]byte, error) {
+	labels := map[string]string{"app": SyntheticExporterName}
+	replicas := int32(1)
+	objects := []interface{}{
+		&corev1.Namespace{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   SyntheticExporterNamespace,
+				Labels: map[string]string{"openshift.io/cluster-monitoring": "true"},
+			},
+		},
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Name: SyntheticExporterName, Namespace: SyntheticExporterNamespace},
+			Rules: []rbacv1.PolicyRule{
+				{
+					APIGroups: []string{""},
+					Resources: []string{"services", "endpoints", "pods"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+			},
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: SyntheticExporterName, Namespace: SyntheticExporterNamespace},
+			RoleRef: rbacv1.RoleRef{
+				Kind:     "Role",
+				Name:     SyntheticExporterName,
+				APIGroup: "rbac.authorization.k8s.io",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      "prometheus-k8s",
+					Namespace: "openshift-monitoring",
+				},
+			},
+		},
+		&corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: SyntheticExporterName, Namespace: SyntheticExporterNamespace},
+			Data:       map[string]string{"metrics": RenderSyntheticMetrics(metrics)},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: SyntheticExporterName, Namespace: SyntheticExporterNamespace},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:    "httpd",
+								Image:   SyntheticExporterImage,
+								Command: []string{"httpd", "-f", "-p", strconv.Itoa(syntheticExporterPort), "-h", "/www"},
+								Ports: []corev1.ContainerPort{
+									{Name: "metrics", ContainerPort: syntheticExporterPort},
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{Name: "metrics", MountPath: "/www"},
+								},
+							},
+						},
+						Volumes: []corev1.Volume{
+							{
+								Name: "metrics",
+								VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{
+										LocalObjectReference: corev1.LocalObjectReference{Name: SyntheticExporterName},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		&corev1.Service{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      SyntheticExporterName,
+				Namespace: SyntheticExporterNamespace,
+				Labels:    labels,
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports: []corev1.ServicePort{
+					{Name: "metrics", Port: syntheticExporterPort, TargetPort: intstr.FromString("metrics")},
+				},
+			},
+		},
+		map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "ServiceMonitor",
+			"metadata": map[string]interface{}{
+				"name":      SyntheticExporterName,
+				"namespace": SyntheticExporterNamespace,
+			},
+			"spec": map[string]interface{}{
+				"selector":  map[string]interface{}{"matchLabels": labels},
+				"endpoints": []interface{}{map[string]interface{}{"port": "metrics", "interval": "15s"}},
+			},
+		},
+	}
+
+	return MarshalYaml(objects)
+}
+
+// DeploySyntheticExporter deploys the exporter serving the metrics on the hub or the managed cluster,
+// updating the served metrics if it is deployed already
+func DeploySyntheticExporter(opt TestOptions, isHub bool, metrics []SyntheticMetric) error {
+	yamlB, err := syntheticExporterYaml(metrics)
+	if err != nil {
+		return err
+	}
+	url, kubeConfig, kubeContext := getClusterAccess(opt, isHub)
+	return Apply(url, kubeConfig, kubeContext, yamlB)
+}
+
+// DeleteSyntheticExporter deletes the namespace of the exporter
+func DeleteSyntheticExporter(opt TestOptions, isHub bool) error {
+	return DeleteNamespace(opt, isHub, SyntheticExporterNamespace)
+}
+
+// UpdateCustomAllowlist adds the names and renames to the custom metrics allowlist on the hub,
+// or removes them if remove is true, keeping the entries added by others. The configmap is deleted
+// once the allowlist has no entry left
+func UpdateCustomAllowlist(opt TestOptions, names []string, renames map[string]string, remove bool) error {
+	allowlist := &MetricsAllowlist{}
+	err, cm := GetConfigMap(opt, true, CustomAllowlistConfigMapName, MCO_NAMESPACE)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: CustomAllowlistConfigMapName, Namespace: MCO_NAMESPACE},
+		}
+	} else {
+		allowlist, err = ParseMetricsAllowlist([]byte(cm.Data[AllowlistConfigMapKey]))
+		if err != nil {
+			return err
+		}
+	}
+
+	set := map[string]bool{}
+	for _, name := range allowlist.Names {
+		set[name] = true
+	}
+	for _, name := range names {
+		set[name] = !remove
+	}
+	allowlist.Names = []string{}
+	for name, ok := range set {
+		if ok {
+			allowlist.Names = append(allowlist.Names, name)
+		}
+	}
+	sort.Strings(allowlist.Names)
+	for from, to := range renames {
+		if remove {
+			delete(allowlist.Renames, from)
+			continue
+		}
+		if allowlist.Renames == nil {
+			allowlist.Renames = map[string]string{}
+		}
+		allowlist.Renames[from] = to
+	}
+
+	if len(allowlist.Names) == 0 && len(allowlist.Matches) == 0 && len(allowlist.Renames) == 0 &&
+		len(allowlist.RecordingRules) == 0 {
+		// the configmap does not exist, there is nothing to delete
+		if cm.ResourceVersion == "" {
+			return nil
+		}
+		err := DeleteConfigMap(opt, true, CustomAllowlistConfigMapName, MCO_NAMESPACE)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(allowlist)
+	if err != nil {
+		return err
+	}
+	cm.Data = map[string]string{AllowlistConfigMapKey: string(data)}
+	return CreateConfigMap(opt, true, cm)
+}
+
+// CheckSyntheticMetrics checks the series of the synthetic metrics arrive on the hub for the cluster
+// with the exact value, the scripted labels and the cluster and clusterID labels. The metrics are
+// expected under their new name if they are renamed
+func CheckSyntheticMetrics(client *PrometheusClient, cluster string, metrics []SyntheticMetric, renames map[string]string) error {
+	for _, metric := range metrics {
+		name := metric.Name
+		if to, ok := renames[name]; ok {
+			name = to
+		}
+		query, err := BuildQuery(Metric(name).Labels(metric.Labels).Eq("cluster", cluster))
+		if err != nil {
+			return err
+		}
+		vector, err := client.QueryVector(query)
+		if err != nil {
+			return err
+		}
+		if len(vector) != 1 {
+			return fmt.Errorf("query %s returned %d series instead of 1", query, len(vector))
+		}
+		sample := vector[0]
+		if float64(sample.Value) != metric.Value {
+			return fmt.Errorf("series %s has value %v instead of %v", sample.Metric, sample.Value, metric.Value)
+		}
+		if sample.Metric["clusterID"] == "" {
+			return fmt.Errorf("series %s has no clusterID label", sample.Metric)
+		}
+		if err := checkSyntheticLabels(sample.Metric, metric.Labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSyntheticLabels checks the series has the scripted labels, cluster and clusterID, and no other
+// label than the ones added by the pipeline
+func checkSyntheticLabels(series model.Metric, scripted map[string]string) error {
+	allowed := map[model.LabelName]bool{model.MetricNameLabel: true, "cluster": true, "clusterID": true}
+	for _, name := range SyntheticPipelineLabels {
+		allowed[model.LabelName(name)] = true
+	}
+	for name, value := range scripted {
+		if string(series[model.LabelName(name)]) != value {
+			return fmt.Errorf("series %s has %s=%q instead of %q", series, name, series[model.LabelName(name)], value)
+		}
+		allowed[model.LabelName(name)] = true
+	}
+	unexpected := []string{}
+	for name := range series {
+		if !allowed[name] {
+			unexpected = append(unexpected, string(name))
+		}
+	}
+	if len(unexpected) > 0 {
+		sort.Strings(unexpected)
+		return fmt.Errorf("series %s has the unexpected labels %v", series, unexpected)
+	}
+	return nil
+}
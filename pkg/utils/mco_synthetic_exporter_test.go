@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderSyntheticMetrics(t *testing.T) {
+	text := RenderSyntheticMetrics([]SyntheticMetric{
+		{Name: "e2e_synthetic_gauge", Labels: map[string]string{"shard": "1", "scenario": `quote"d`}, Value: 0.125},
+		{Name: "e2e_synthetic_counter", Value: 7},
+		{Name: "e2e_synthetic_gauge", Labels: map[string]string{"shard": "0"}, Value: 42},
+	})
+	assert.Equal(t, `# TYPE e2e_synthetic_counter gauge
+e2e_synthetic_counter 7
+# TYPE e2e_synthetic_gauge gauge
+e2e_synthetic_gauge{scenario="quote\"d",shard="1"} 0.125
+e2e_synthetic_gauge{shard="0"} 42
+`, text)
+
+	yamlB, err := syntheticExporterYaml([]SyntheticMetric{{Name: "e2e_synthetic_counter", Value: 7}})
+	require.NoError(t, err)
+	docs := strings.Split(string(yamlB), "---")
+	assert.Len(t, docs, 7)
+	assert.Contains(t, docs[len(docs)-1], "kind: ServiceMonitor")
+}
+
+func TestCheckSyntheticMetrics(t *testing.T) {
+	server := newFakeQueryAPI(t, map[string]string{
+		`e2e_synthetic_gauge{shard="0",cluster="cluster1"}`: `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"e2e_synthetic_gauge","shard":"0","cluster":"cluster1","clusterID":"1234","job":"observability-e2e-exporter"},"value":[1617000000,"42"]}]}}`,
+		`e2e_synthetic_leaked{cluster="cluster1"}`: `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"e2e_synthetic_leaked","cluster":"cluster1","clusterID":"1234","shard":"0"},"value":[1617000000,"1"]}]}}`,
+		`e2e_synthetic_renamed_total{cluster="cluster1"}`: `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"e2e_synthetic_renamed_total","cluster":"cluster1"},"value":[1617000000,"7"]}]}}`,
+	})
+	defer server.Close()
+	client := &PrometheusClient{URL: server.URL, Auth: BearerTokenAuth("test-token")}
+
+	gauge := SyntheticMetric{Name: "e2e_synthetic_gauge", Labels: map[string]string{"shard": "0"}, Value: 42}
+	assert.NoError(t, CheckSyntheticMetrics(client, "cluster1", []SyntheticMetric{gauge}, nil))
+
+	gauge.Value = 41
+	assert.Error(t, CheckSyntheticMetrics(client, "cluster1", []SyntheticMetric{gauge}, nil), "wrong value")
+
+	leaked := SyntheticMetric{Name: "e2e_synthetic_leaked", Value: 1}
+	err := CheckSyntheticMetrics(client, "cluster1", []SyntheticMetric{leaked}, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unexpected labels [shard]")
+	}
+
+	renamed := SyntheticMetric{Name: "e2e_synthetic_renamed", Value: 7}
+	err = CheckSyntheticMetrics(client, "cluster1", []SyntheticMetric{renamed},
+		map[string]string{"e2e_synthetic_renamed": "e2e_synthetic_renamed_total"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no clusterID label")
+	}
+}
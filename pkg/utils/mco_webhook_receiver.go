@@ -0,0 +1,329 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+)
+
+const (
+	WebhookReceiverName      = "observability-e2e-webhook"
+	WebhookReceiverNamespace = "observability-e2e-webhook"
+	webhookReceiverPort      = 8080
+	webhookReceiverPath      = "/cgi-bin/record"
+)
+
+// webhookReceiverScript is served as CGI by the busybox httpd. Every POSTed payload is appended
+// to the record with the time it is received, and the records are returned as a JSON array on GET
+const webhookReceiverScript = `#!/bin/sh
+RECORD=/tmp/record
+echo "Content-Type: application/json"
+echo ""
+if [ "$REQUEST_METHOD" = "POST" ]; then
+  BODY=$(head -c "$CONTENT_LENGTH" | tr -d '\n')
+  echo "{\"receivedAt\":$(date +%s),\"message\":$BODY}" >> $RECORD
+  echo "{}"
+  exit 0
+fi
+echo "["
+[ -f $RECORD ] && sed '$!s/$/,/' $RECORD
+echo "]"
+`
+
+// WebhookAlert is an alert in the payload sent by the alertmanager webhook receiver
+type WebhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// WebhookMessage is the payload sent by the alertmanager webhook receiver
+type WebhookMessage struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []WebhookAlert    `json:"alerts"`
+}
+
+// WebhookRecord is a webhook payload with the time it is received
+type WebhookRecord struct {
+	ReceivedAt time.Time
+	Message    WebhookMessage
+}
+
+// WebhookRecorder records the payloads sent by alertmanager to a webhook receiver
+type WebhookRecorder interface {
+	// URL is the url to configure in the webhook receiver
+	URL() string
+	// Records returns the payloads received so far
+	Records() ([]WebhookRecord, error)
+}
+
+// LocalWebhookRecorder records the payloads in a HTTP server of the test process, it is
+// reachable by an alertmanager running on the same host
+type LocalWebhookRecorder struct {
+	server  *http.Server
+	url     string
+	mu      sync.Mutex
+	records []WebhookRecord
+}
+
+// NewLocalWebhookRecorder starts recording on the address, e.g. 127.0.0.1:0 for a random port
+func NewLocalWebhookRecorder(addr string) (*LocalWebhookRecorder, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := &LocalWebhookRecorder{url: "http://" + listener.Addr().String() + "/"}
+	r.server = &http.Server{Handler: r}
+	go func() {
+		if err := r.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			klog.Errorf("webhook recorder stopped due to %v", err)
+		}
+	}()
+	return r, nil
+}
+
+func (r *LocalWebhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	message := WebhookMessage{}
+	if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, WebhookRecord{ReceivedAt: time.Now(), Message: message})
+}
+
+func (r *LocalWebhookRecorder) URL() string {
+	return r.url
+}
+
+func (r *LocalWebhookRecorder) Records() ([]WebhookRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]WebhookRecord{}, r.records...), nil
+}
+
+// Close stops the HTTP server
+func (r *LocalWebhookRecorder) Close() error {
+	return r.server.Close()
+}
+
+// ClusterWebhookRecorder records the payloads in a pod on the hub, it is reachable by the
+// alertmanager of the hub through its service
+type ClusterWebhookRecorder struct {
+	opt TestOptions
+}
+
+// webhookReceiverYaml returns the receiver workload: a busybox httpd serving the record script
+func webhookReceiverYaml() ([]byte, error) {
+	labels := map[string]string{"app": WebhookReceiverName}
+	replicas := int32(1)
+	mode := int32(0755)
+	objects := []interface{}{
+		&corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: WebhookReceiverNamespace},
+		},
+		&corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: WebhookReceiverName, Namespace: WebhookReceiverNamespace},
+			Data:       map[string]string{"record": webhookReceiverScript},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: WebhookReceiverName, Namespace: WebhookReceiverNamespace},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:    "httpd",
+								Image:   SyntheticExporterImage,
+								Command: []string{"httpd", "-f", "-p", strconv.Itoa(webhookReceiverPort), "-h", "/www"},
+								Ports: []corev1.ContainerPort{
+									{Name: "http", ContainerPort: webhookReceiverPort},
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{Name: "cgi-bin", MountPath: "/www/cgi-bin"},
+								},
+							},
+						},
+						Volumes: []corev1.Volume{
+							{
+								Name: "cgi-bin",
+								VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{
+										LocalObjectReference: corev1.LocalObjectReference{Name: WebhookReceiverName},
+										DefaultMode:          &mode,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		&corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{Name: WebhookReceiverName, Namespace: WebhookReceiverNamespace},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports: []corev1.ServicePort{
+					{Name: "http", Port: webhookReceiverPort, TargetPort: intstr.FromString("http")},
+				},
+			},
+		},
+	}
+
+	return MarshalYaml(objects)
+}
+
+// DeployWebhookRecorder deploys the receiver on the hub, the previous records are dropped
+// when the pod is recreated
+func DeployWebhookRecorder(opt TestOptions) (*ClusterWebhookRecorder, error) {
+	yamlB, err := webhookReceiverYaml()
+	if err != nil {
+		return nil, err
+	}
+	if err := Apply(opt.HubCluster.MasterURL, opt.KubeConfig, opt.HubCluster.KubeContext, yamlB); err != nil {
+		return nil, err
+	}
+	return &ClusterWebhookRecorder{opt: opt}, nil
+}
+
+// DeleteWebhookRecorder deletes the namespace of the receiver
+func DeleteWebhookRecorder(opt TestOptions) error {
+	return DeleteNamespace(opt, true, WebhookReceiverNamespace)
+}
+
+func (r *ClusterWebhookRecorder) URL() string {
+	return fmt.Sprintf("http://%s.%s.svc:%d%s", WebhookReceiverName, WebhookReceiverNamespace, webhookReceiverPort, webhookReceiverPath)
+}
+
+// Records reads the records from the receiver pod through a forwarded port
+func (r *ClusterWebhookRecorder) Records() ([]WebhookRecord, error) {
+	err, podList := GetPodList(r.opt, true, WebhookReceiverNamespace, "app="+WebhookReceiverName)
+	if err != nil {
+		return nil, err
+	}
+	var pod *corev1.Pod
+	for i := range podList.Items {
+		if podList.Items[i].Status.Phase == corev1.PodRunning && podList.Items[i].DeletionTimestamp == nil {
+			pod = &podList.Items[i]
+		}
+	}
+	if pod == nil {
+		return nil, fmt.Errorf("no running pod of the webhook receiver %s", WebhookReceiverName)
+	}
+
+	port, stop, err := PortForward(r.opt, true, WebhookReceiverNamespace, pod.Name, webhookReceiverPort)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	resp, err := newHTTPClient().Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, webhookReceiverPath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read the webhook records: %s %s", resp.Status, body)
+	}
+	return parseWebhookRecords(body)
+}
+
+// parseWebhookRecords parses the records returned by the receiver script
+func parseWebhookRecords(data []byte) ([]WebhookRecord, error) {
+	raw := []struct {
+		ReceivedAt int64          `json:"receivedAt"`
+		Message    WebhookMessage `json:"message"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode the webhook records: %v", err)
+	}
+	records := []WebhookRecord{}
+	for _, record := range raw {
+		records = append(records, WebhookRecord{ReceivedAt: time.Unix(record.ReceivedAt, 0), Message: record.Message})
+	}
+	return records, nil
+}
+
+// FindDeliveredAlert returns the first record delivering an alert with the labels and the status,
+// firing or resolved, which is received after since. The cluster records have a second precision, so
+// since is truncated to the second
+func FindDeliveredAlert(records []WebhookRecord, labels map[string]string, status string, since time.Time) (*WebhookRecord, *WebhookAlert) {
+	since = since.Truncate(time.Second)
+	for i := range records {
+		if records[i].ReceivedAt.Before(since) {
+			continue
+		}
+		for j, alert := range records[i].Message.Alerts {
+			if alert.Status != status {
+				continue
+			}
+			matched := true
+			for name, value := range labels {
+				matched = matched && alert.Labels[name] == value
+			}
+			if matched {
+				return &records[i], &records[i].Message.Alerts[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// CheckAlertDelivered checks an alert with the labels and the status has been delivered to the
+// recorder within the duration after since
+func CheckAlertDelivered(recorder WebhookRecorder, labels map[string]string, status string, since time.Time, within time.Duration) error {
+	records, err := recorder.Records()
+	if err != nil {
+		return err
+	}
+	record, _ := FindDeliveredAlert(records, labels, status, since)
+	if record == nil {
+		return fmt.Errorf("no %s alert with labels %v delivered since %s in %d payloads", status, labels, since.Format(time.RFC3339), len(records))
+	}
+	// the records of the cluster recorder are truncated to seconds
+	if delay := record.ReceivedAt.Sub(since.Truncate(time.Second)); delay > within {
+		return fmt.Errorf("%s alert with labels %v delivered after %s, longer than %s", status, labels, delay, within)
+	}
+	klog.V(1).Infof("%s alert with labels %v delivered to %s at %s", status, labels, record.Message.Receiver, record.ReceivedAt)
+	return nil
+}
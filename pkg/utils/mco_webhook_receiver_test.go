@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookPayload = `{"version":"4","groupKey":"{}:{alertname=\"NodeDown\"}","status":"firing","receiver":"default-receiver",
+	"groupLabels":{"alertname":"NodeDown"},"commonLabels":{"alertname":"NodeDown","cluster":"local-cluster"},
+	"alerts":[{"status":"firing","labels":{"alertname":"NodeDown","cluster":"local-cluster"},
+	"startsAt":"2021-04-01T00:00:00Z","endsAt":"0001-01-01T00:00:00Z","fingerprint":"a1b2"}]}`
+
+func TestLocalWebhookRecorder(t *testing.T) {
+	recorder, err := NewLocalWebhookRecorder("127.0.0.1:0")
+	require.NoError(t, err)
+	defer recorder.Close()
+	labels := map[string]string{"alertname": "NodeDown", "cluster": "local-cluster"}
+	since := time.Now()
+
+	assert.Error(t, CheckAlertDelivered(recorder, labels, "firing", since, time.Minute))
+
+	resp, err := http.Post(recorder.URL(), "application/json", strings.NewReader(testWebhookPayload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	records, err := recorder.Records()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "default-receiver", records[0].Message.Receiver)
+	assert.NoError(t, CheckAlertDelivered(recorder, labels, "firing", since, time.Minute))
+	assert.Error(t, CheckAlertDelivered(recorder, labels, "resolved", since, time.Minute))
+	assert.Error(t, CheckAlertDelivered(recorder, map[string]string{"cluster": "cluster1"}, "firing", since, time.Minute))
+	assert.Error(t, CheckAlertDelivered(recorder, labels, "firing", time.Now().Add(time.Minute), time.Minute),
+		"the payload is received before since")
+	assert.Error(t, CheckAlertDelivered(recorder, labels, "firing", since.Add(-time.Hour), time.Minute),
+		"the payload is received later than within")
+}
+
+func TestParseWebhookRecords(t *testing.T) {
+	records, err := parseWebhookRecords([]byte("[\n{\"receivedAt\":1617000030,\"message\":" + testWebhookPayload + "}\n]\n"))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, time.Unix(1617000030, 0), records[0].ReceivedAt)
+
+	record, alert := FindDeliveredAlert(records, map[string]string{"alertname": "NodeDown"}, "firing", time.Unix(1617000000, 0))
+	require.NotNil(t, record)
+	assert.Equal(t, "a1b2", alert.Fingerprint)
+	record, _ = FindDeliveredAlert(records, map[string]string{"alertname": "NodeDown"}, "firing", time.Unix(1617000030, 500000000))
+	assert.NotNil(t, record, "the payload received in the same second is found")
+	record, _ = FindDeliveredAlert(records, map[string]string{"alertname": "NodeDown"}, "firing", time.Unix(1617000031, 0))
+	assert.Nil(t, record)
+
+	records, err = parseWebhookRecords([]byte("[\n]\n"))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
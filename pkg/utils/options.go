@@ -3,6 +3,8 @@
 
 package utils
 
+import "github.com/prometheus/common/model"
+
 type TestOptionsContainer struct {
 	Options TestOptions `yaml:"options"`
 }
@@ -16,21 +18,72 @@ type TestOptions struct {
 	Connection      CloudConnection `yaml:"cloudConnection,omitempty"`
 	Headless        string          `yaml:"headless,omitempty"`
 	OwnerPrefix     string          `yaml:"ownerPrefix,omitempty"`
+	// path to a file with the expected nodeSelector, tolerations and anti-affinity of the MCO pods,
+	// the expectations are taken from the MCO spec if not set
+	SchedulingExpectations string `yaml:"schedulingExpectations,omitempty"`
+	// the endpoint used to query the metrics of the hub, see QueryEndpoint
+	QueryEndpoint QueryEndpoint `yaml:"queryEndpoint,omitempty"`
+	// path to a file with the maximum number of series per managed cluster and per metric name,
+	// DefaultCardinalityBudget is used if not set
+	CardinalityBudget string `yaml:"cardinalityBudget,omitempty"`
+	// the maximum lag between a sample being scraped on a managed cluster and being queryable on the hub
+	IngestionLagSLO IngestionLagSLO `yaml:"ingestionLagSLO,omitempty"`
+	// how the requests to grafana are authenticated, see GrafanaAuth
+	GrafanaAuth GrafanaAuth `yaml:"grafanaAuth,omitempty"`
+}
+
+// Define the endpoint serving the Prometheus HTTP API of the hub
+type QueryEndpoint struct {
+	// one of grafana, query-frontend or rbac-query-proxy, defaults to query-frontend if the
+	// THANOS_QUERY_FRONTEND_URL env is set out of the canary environment, otherwise grafana
+	Type string `yaml:"type,omitempty"`
+	// URL of grafana, the thanos query frontend or the rbac-query-proxy route
+	URL string `yaml:"url,omitempty"`
+	// Host overrides the Host header of the requests
+	Host string `yaml:"host,omitempty"`
+	// name of the grafana datasource the queries are proxied to, defaults to Observatorium
+	Datasource string `yaml:"datasource,omitempty"`
+	// token sent to grafana and the rbac-query-proxy, defaults to the token of the testing service account
+	BearerToken string `yaml:"bearerToken,omitempty"`
+}
+
+// Define how the requests to grafana are authenticated
+type GrafanaAuth struct {
+	// one of bearer (through the oauth proxy), forwarded-user (bypassing the oauth proxy), basic or none,
+	// defaults to bearer in the canary environment, otherwise forwarded-user
+	Mode string `yaml:"mode,omitempty"`
+	// token of the bearer mode, defaults to the token of the testing service account
+	BearerToken string `yaml:"bearerToken,omitempty"`
+	// user of the forwarded-user mode, defaults to the grafana admin
+	User string `yaml:"user,omitempty"`
+	// credentials of the basic mode
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// Define the ingestion lag SLO, DefaultIngestionLagSLO is used for the unset values
+type IngestionLagSLO struct {
+	P95 model.Duration `yaml:"p95,omitempty"`
+	Max model.Duration `yaml:"max,omitempty"`
 }
 
 // Define the shape of clusters that may be added under management
 type Cluster struct {
-	Name        string          `yaml:"name,omitempty"`
-	Namespace   string          `yaml:"namespace,omitempty"`
-	Tags        map[string]bool `yaml:"tags,omitempty"`
-	BaseDomain  string          `yaml:"baseDomain"`
-	User        string          `yaml:"user,omitempty"`
-	Password    string          `yaml:"password,omitempty"`
-	KubeContext string          `yaml:"kubecontext,omitempty"`
-	MasterURL   string          `yaml:"masterURL,omitempty"`
-	GrafanaURL  string          `yaml:"grafanaURL,omitempty"`
-	GrafanaHost string          `yaml:"grafanaHost,omitempty"`
-	KubeConfig  string          `yaml:"kubeconfig,omitempty"`
+	Name            string          `yaml:"name,omitempty"`
+	Namespace       string          `yaml:"namespace,omitempty"`
+	Tags            map[string]bool `yaml:"tags,omitempty"`
+	BaseDomain      string          `yaml:"baseDomain"`
+	User            string          `yaml:"user,omitempty"`
+	Password        string          `yaml:"password,omitempty"`
+	KubeContext     string          `yaml:"kubecontext,omitempty"`
+	MasterURL       string          `yaml:"masterURL,omitempty"`
+	GrafanaURL      string          `yaml:"grafanaURL,omitempty"`
+	GrafanaHost     string          `yaml:"grafanaHost,omitempty"`
+	AlertmanagerURL string          `yaml:"alertmanagerURL,omitempty"`
+	KubeConfig      string          `yaml:"kubeconfig,omitempty"`
+	// forward a port of a grafana pod instead of accessing grafanaURL, for the grafana API and
+	// the metric queries sent to grafana
+	GrafanaPortForward bool `yaml:"grafanaPortForward,omitempty"`
 }
 
 // Define the image registry
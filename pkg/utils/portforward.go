@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/klog"
+)
+
+// PortForward forwards a random local port to the port of the pod, so that the endpoints
+// which are not exposed by a route can be reached from the tests. The forwarding lasts
+// until the returned stop function is called
+func PortForward(opt TestOptions, isHub bool, namespace, pod string, port int) (int, func(), error) {
+	config, err := LoadConfig(getClusterAccess(opt, isHub))
+	if err != nil {
+		return 0, nil, err
+	}
+	clientKube, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return 0, nil, err
+	}
+	roundTripper, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	reqURL := clientKube.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, "POST", reqURL)
+
+	stopCh := make(chan struct{})
+	readyCh := make(chan struct{})
+	errOut := &bytes.Buffer{}
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"},
+		[]string{fmt.Sprintf("0:%d", port)}, stopCh, readyCh, ioutil.Discard, errOut)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- forwarder.ForwardPorts()
+	}()
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return 0, nil, fmt.Errorf("failed to forward port %d of pod %s/%s: %v %s", port, namespace, pod, err, errOut)
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		close(stopCh)
+		return 0, nil, err
+	}
+	localPort := int(ports[0].Local)
+	klog.V(3).Infof("forwarding 127.0.0.1:%d to %s/%s:%d", localPort, namespace, pod, port)
+	return localPort, func() { close(stopCh) }, nil
+}
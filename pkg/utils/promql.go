@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// PromQLExpr is a PromQL expression built by the helpers below
+type PromQLExpr interface {
+	String() string
+}
+
+// Selector is a series selector, e.g. ALERTS{alertname="Watchdog"}[5m] offset 1m
+type Selector struct {
+	name     string
+	matchers []string
+	rng      time.Duration
+	offset   time.Duration
+}
+
+// Metric starts a selector for the series of the metric, the name can be empty
+// to select by labels only
+func Metric(name string) *Selector {
+	return &Selector{name: name}
+}
+
+// match appends a matcher, the value is quoted so that it can contain any character,
+// the metric and label names are checked by the parser in BuildQuery
+func (s *Selector) match(label, op, value string) *Selector {
+	s.matchers = append(s.matchers, label+op+strconv.Quote(value))
+	return s
+}
+
+// Eq selects the series with the label equal to value
+func (s *Selector) Eq(label, value string) *Selector {
+	return s.match(label, "=", value)
+}
+
+// Neq selects the series with the label not equal to value
+func (s *Selector) Neq(label, value string) *Selector {
+	return s.match(label, "!=", value)
+}
+
+// Re selects the series with the label matching the regular expression
+func (s *Selector) Re(label, regex string) *Selector {
+	return s.match(label, "=~", regex)
+}
+
+// Nre selects the series with the label not matching the regular expression
+func (s *Selector) Nre(label, regex string) *Selector {
+	return s.match(label, "!~", regex)
+}
+
+// Labels selects the series with all the label values, in the order of the label names
+func (s *Selector) Labels(labels map[string]string) *Selector {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.Eq(name, labels[name])
+	}
+	return s
+}
+
+// Range turns the selector into a range vector selector
+func (s *Selector) Range(d time.Duration) *Selector {
+	s.rng = d
+	return s
+}
+
+// Offset shifts the selector back in time
+func (s *Selector) Offset(d time.Duration) *Selector {
+	s.offset = d
+	return s
+}
+
+func (s *Selector) String() string {
+	var b strings.Builder
+	b.WriteString(s.name)
+	if len(s.matchers) > 0 || s.name == "" {
+		b.WriteString("{" + strings.Join(s.matchers, ",") + "}")
+	}
+	if s.rng > 0 {
+		b.WriteString("[" + model.Duration(s.rng).String() + "]")
+	}
+	if s.offset > 0 {
+		b.WriteString(" offset " + model.Duration(s.offset).String())
+	}
+	return b.String()
+}
+
+type rawExpr string
+
+func (e rawExpr) String() string {
+	return string(e)
+}
+
+// Number is a scalar literal
+func Number(n float64) PromQLExpr {
+	return rawExpr(strconv.FormatFloat(n, 'f', -1, 64))
+}
+
+// Func calls a PromQL function, e.g. Func("rate", Metric("up").Range(time.Minute))
+func Func(name string, args ...PromQLExpr) PromQLExpr {
+	strs := make([]string, 0, len(args))
+	for _, arg := range args {
+		strs = append(strs, arg.String())
+	}
+	return rawExpr(name + "(" + strings.Join(strs, ", ") + ")")
+}
+
+// Aggregate applies an aggregation operator grouped by the labels, e.g. Aggregate("count", expr, "cluster")
+func Aggregate(op string, expr PromQLExpr, by ...string) PromQLExpr {
+	if len(by) == 0 {
+		return rawExpr(op + "(" + expr.String() + ")")
+	}
+	return rawExpr(op + " by (" + strings.Join(by, ", ") + ") (" + expr.String() + ")")
+}
+
+// Binary combines two expressions with a binary operator, e.g. Binary(expr, ">", Number(0))
+func Binary(lhs PromQLExpr, op string, rhs PromQLExpr) PromQLExpr {
+	return rawExpr(lhs.String() + " " + op + " " + rhs.String())
+}
+
+// BuildQuery renders the expression and checks it with the PromQL parser, so a malformed
+// query fails before it is sent instead of silently never matching
+func BuildQuery(expr PromQLExpr) (string, error) {
+	query := expr.String()
+	if _, err := parser.ParseExpr(query); err != nil {
+		return "", fmt.Errorf("invalid query %s: %v", query, err)
+	}
+	return query, nil
+}
+
+// MustBuildQuery is like BuildQuery but panics if the query is invalid
+func MustBuildQuery(expr PromQLExpr) string {
+	query, err := BuildQuery(expr)
+	if err != nil {
+		panic(err)
+	}
+	return query
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildQuery(t *testing.T) {
+	cases := []struct {
+		expr     PromQLExpr
+		expected string
+	}{
+		{
+			expr:     Metric("ALERTS").Eq("alertname", "NodeOutOfMemory").Offset(time.Minute),
+			expected: `ALERTS{alertname="NodeOutOfMemory"} offset 1m`,
+		},
+		{
+			expr:     Metric("node_memory_MemAvailable_bytes").Eq("cluster", `my"cluster\`),
+			expected: `node_memory_MemAvailable_bytes{cluster="my\"cluster\\"}`,
+		},
+		{
+			expr:     Metric("").Re("__name__", "node_.+").Neq("job", "").Nre("cluster", "local-.*"),
+			expected: `{__name__=~"node_.+",job!="",cluster!~"local-.*"}`,
+		},
+		{
+			expr:     Aggregate("count", Metric("").Labels(map[string]string{"cluster": "c1", "__name__": "up"}), "cluster"),
+			expected: `count by (cluster) ({__name__="up",cluster="c1"})`,
+		},
+		{
+			expr:     Binary(Func("rate", Metric("up").Range(5*time.Minute)), ">", Number(0.5)),
+			expected: `rate(up[5m]) > 0.5`,
+		},
+	}
+	for _, c := range cases {
+		query, err := BuildQuery(c.expr)
+		require.NoError(t, err, c.expected)
+		assert.Equal(t, c.expected, query)
+	}
+}
+
+func TestBuildQueryInvalid(t *testing.T) {
+	for _, expr := range []PromQLExpr{
+		Metric("ALERTS").Eq("alert-name", "Watchdog"),
+		Func("no_such_function", Metric("up")),
+		Aggregate("sum", Metric("up").Range(time.Minute)),
+	} {
+		_, err := BuildQuery(expr)
+		assert.Error(t, err, expr.String())
+	}
+	assert.Panics(t, func() { MustBuildQuery(Metric("").Eq("", "x")) })
+}
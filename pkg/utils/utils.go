@@ -19,6 +19,7 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/klog"
@@ -234,6 +235,30 @@ func LoadConfig(url, kubeconfig, context string) (*rest.Config, error) {
 
 }
 
+//MarshalYaml marshals the objects into a multi resources file which can be applied with Apply
+func MarshalYaml(objects []interface{}) ([]byte, error) {
+	docs := []string{}
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(data))
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+//DeleteNamespace deletes the namespace and the resources in it, a namespace which does not exist is ignored
+func DeleteNamespace(opt TestOptions, isHub bool, name string) error {
+	clientKube := getKubeClient(opt, isHub)
+	err := clientKube.CoreV1().Namespaces().Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		klog.Errorf("Failed to delete namespace %s due to %v", name, err)
+		return err
+	}
+	return nil
+}
+
 //Apply a multi resources file to the cluster described by the url, kubeconfig and context.
 //url of the cluster
 //kubeconfig which contains the context
@@ -336,6 +361,36 @@ func Apply(url string, kubeconfig string, context string, yamlB []byte) error {
 				klog.Warningf("%s %s/%s already exists, updating!", obj.Kind, obj.Namespace, obj.Name)
 				_, err = clientKube.RbacV1().ClusterRoleBindings().Update(obj)
 			}
+		case "Role":
+			klog.V(5).Infof("Install %s: %s\n", kind, f)
+			obj := &rbacv1.Role{}
+			err = yaml.Unmarshal([]byte(f), obj)
+			if err != nil {
+				return err
+			}
+			existingObject, errGet := clientKube.RbacV1().Roles(obj.Namespace).Get(obj.Name, metav1.GetOptions{})
+			if errGet != nil {
+				_, err = clientKube.RbacV1().Roles(obj.Namespace).Create(obj)
+			} else {
+				obj.ObjectMeta = existingObject.ObjectMeta
+				klog.Warningf("%s %s/%s already exists, updating!", obj.Kind, obj.Namespace, obj.Name)
+				_, err = clientKube.RbacV1().Roles(obj.Namespace).Update(obj)
+			}
+		case "RoleBinding":
+			klog.V(5).Infof("Install %s: %s\n", kind, f)
+			obj := &rbacv1.RoleBinding{}
+			err = yaml.Unmarshal([]byte(f), obj)
+			if err != nil {
+				return err
+			}
+			existingObject, errGet := clientKube.RbacV1().RoleBindings(obj.Namespace).Get(obj.Name, metav1.GetOptions{})
+			if errGet != nil {
+				_, err = clientKube.RbacV1().RoleBindings(obj.Namespace).Create(obj)
+			} else {
+				obj.ObjectMeta = existingObject.ObjectMeta
+				klog.Warningf("%s %s/%s already exists, updating!", obj.Kind, obj.Namespace, obj.Name)
+				_, err = clientKube.RbacV1().RoleBindings(obj.Namespace).Update(obj)
+			}
 		case "Secret":
 			klog.V(5).Infof("Install %s: %s\n", kind, f)
 			obj := &corev1.Secret{}
@@ -446,18 +501,20 @@ func Apply(url string, kubeconfig string, context string, yamlB []byte) error {
 			}
 
 		default:
+			gvr := NewMCOGVRV1BETA2()
 			switch kind {
 			case "MultiClusterObservability":
 				klog.V(5).Infof("Install MultiClusterObservability: %s\n", f)
+				if apiVersion == "observability.open-cluster-management.io/v1beta1" {
+					gvr = NewMCOGVRV1BETA1()
+				}
+			case "ServiceMonitor":
+				klog.V(5).Infof("Install ServiceMonitor: %s\n", f)
+				gvr = NewServiceMonitorGVR()
 			default:
 				return fmt.Errorf("Resource %s not supported", kind)
 			}
 
-			gvr := NewMCOGVRV1BETA2()
-			if apiVersion == "observability.open-cluster-management.io/v1beta1" {
-				gvr = NewMCOGVRV1BETA1()
-			}
-
 			clientDynamic := NewKubeClientDynamic(url, kubeconfig, context)
 			if ns := obj.GetNamespace(); ns != "" {
 				existingObject, errGet := clientDynamic.Resource(gvr).Namespace(ns).Get(obj.GetName(), metav1.GetOptions{})